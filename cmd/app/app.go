@@ -2,22 +2,45 @@ package app
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/yaml.v2"
 
 	"urlshortener/internal/api/handler"
+	"urlshortener/internal/cache"
+	"urlshortener/internal/clickqueue"
 	usstorage "urlshortener/internal/db"
+	"urlshortener/internal/geoip"
+	"urlshortener/internal/health"
+	"urlshortener/internal/janitor"
+	"urlshortener/internal/policy"
+	"urlshortener/internal/ratelimit"
+	"urlshortener/internal/realip"
 	"urlshortener/internal/repos/usrepo"
 )
 
@@ -26,8 +49,60 @@ type config struct {
 	ConnectionString string `yaml:"connectionString"`
 	LogLevel         string `yaml:"logLevel"`
 	Port             int    `yaml:"port"`
+	AdminPort        int    `yaml:"adminPort"`
 	WriteTimeout     int    `yaml:"writetimeout"`
 	ReadTimeout      int    `yaml:"readtimeout"`
+
+	ShutdownDelaySeconds int `yaml:"shutdownDelaySeconds"`
+
+	DefaultTTLDays    int  `yaml:"defaultTTLDays"`
+	MaxTTLDays        int  `yaml:"maxTTLDays"`
+	AllowNeverExpires bool `yaml:"allowNeverExpires"`
+
+	StripTrackingParams bool `yaml:"stripTrackingParams"`
+
+	DestinationAllow       []string `yaml:"destinationAllow"`
+	DestinationDeny        []string `yaml:"destinationDeny"`
+	BlocklistFile          string   `yaml:"blocklistFile"`
+	BlocklistReloadSeconds int      `yaml:"blocklistReloadSeconds"`
+	BlockPrivateIPs        *bool    `yaml:"blockPrivateIPs"`
+
+	GeoIPDatabase string `yaml:"geoipDatabase"`
+
+	JanitorIntervalMinutes int `yaml:"janitorIntervalMinutes"`
+	JanitorBatchSize       int `yaml:"janitorBatchSize"`
+	ClickRetentionDays     int `yaml:"clickRetentionDays"`
+	IdempotencyKeyTTLHours int `yaml:"idempotencyKeyTTLHours"`
+
+	ClickQueueSize       int `yaml:"clickQueueSize"`
+	ClickBatchSize       int `yaml:"clickBatchSize"`
+	ClickFlushIntervalMs int `yaml:"clickFlushIntervalMs"`
+
+	CacheType       string `yaml:"cacheType"`
+	CacheSize       int    `yaml:"cacheSize"`
+	CacheTTLSeconds int    `yaml:"cacheTTLSeconds"`
+	RedisURL        string `yaml:"redisURL"`
+
+	AllowAnonymousCreate *bool `yaml:"allowAnonymousCreate"`
+	PublicForm           *bool `yaml:"publicForm"`
+
+	TrustedProxies []string `yaml:"trustedProxies"`
+
+	RateLimitStore        string `yaml:"rateLimitStore"`
+	RateLimitKey          string `yaml:"rateLimitKey"`
+	CreateRatePerMinute   int    `yaml:"createRatePerMinute"`
+	CreateRateBurst       int    `yaml:"createRateBurst"`
+	RedirectRatePerMinute int    `yaml:"redirectRatePerMinute"`
+	RedirectRateBurst     int    `yaml:"redirectRateBurst"`
+	StatsRatePerMinute    int    `yaml:"statsRatePerMinute"`
+	StatsRateBurst        int    `yaml:"statsRateBurst"`
+	AuthRatePerMinute     int    `yaml:"authRatePerMinute"`
+	AuthRateBurst         int    `yaml:"authRateBurst"`
+
+	TracingExporter    string `yaml:"tracingExporter"`
+	TracingEndpoint    string `yaml:"tracingEndpoint"`
+	TracingFile        string `yaml:"tracingFile"`
+	TracingServiceName string `yaml:"tracingServiceName"`
 }
 
 type app struct {
@@ -42,21 +117,122 @@ const defaultLogLevel = logrus.InfoLevel
 const defaultPort = 8080
 const defaultWriteTimeout = 10
 const defaultReadTimeout = 10
+const defaultDefaultTTLDays = 30
+const defaultJanitorIntervalMinutes = 60
+const defaultJanitorBatchSize = 500
+const defaultIdempotencyKeyTTLHours = 24
+const defaultClickQueueSize = 10000
+const defaultClickBatchSize = 100
+const defaultClickFlushIntervalMs = 1000
+const defaultCacheSize = 10000
+const defaultCacheTTLSeconds = 300
+const redisTimeout = 2 * time.Second
+const readinessTimeout = 2 * time.Second
+const defaultAllowAnonymousCreate = true
+const defaultPublicForm = true
+const defaultBlocklistReloadSeconds = 30
+const defaultBlockPrivateIPs = true
+const defaultRateLimitKey = "ip"
+const defaultCreateRatePerMinute = 30
+const defaultRedirectRatePerMinute = 600
+const defaultStatsRatePerMinute = 120
+const defaultAuthRatePerMinute = 300
+const defaultTracingServiceName = "urlshortener"
+const tracingQueueSize = 2048
+const tracingBatchSize = 512
+const tracingFlushInterval = 5 * time.Second
+const tracingExportTimeout = 10 * time.Second
 
 func getConfig(log *logrus.Logger, configPath string) *config {
 	log.Info("loading settings")
 
 	//для Heroku сделано получение конфигурации из переменных среды
 	envPort, _ := strconv.Atoi(os.Getenv("PORT"))
+	envAdminPort, _ := strconv.Atoi(os.Getenv("ADMINPORT"))
 	envWriteTimeout, _ := strconv.Atoi(os.Getenv("WRITETIMAOUT"))
 	envReadTimeout, _ := strconv.Atoi(os.Getenv("READTIMEOUT"))
+	envShutdownDelaySeconds, _ := strconv.Atoi(os.Getenv("SHUTDOWNDELAYSECONDS"))
+	envDefaultTTLDays, _ := strconv.Atoi(os.Getenv("DEFAULTTTLDAYS"))
+	envMaxTTLDays, _ := strconv.Atoi(os.Getenv("MAXTTLDAYS"))
+	envAllowNeverExpires, _ := strconv.ParseBool(os.Getenv("ALLOWNEVEREXPIRES"))
+	envStripTrackingParams, _ := strconv.ParseBool(os.Getenv("STRIPTRACKINGPARAMS"))
+	envJanitorIntervalMinutes, _ := strconv.Atoi(os.Getenv("JANITORINTERVALMINUTES"))
+	envJanitorBatchSize, _ := strconv.Atoi(os.Getenv("JANITORBATCHSIZE"))
+	envClickRetentionDays, _ := strconv.Atoi(os.Getenv("CLICKRETENTIONDAYS"))
+	envIdempotencyKeyTTLHours, _ := strconv.Atoi(os.Getenv("IDEMPOTENCYKEYTTLHOURS"))
+	envClickQueueSize, _ := strconv.Atoi(os.Getenv("CLICKQUEUESIZE"))
+	envClickBatchSize, _ := strconv.Atoi(os.Getenv("CLICKBATCHSIZE"))
+	envClickFlushIntervalMs, _ := strconv.Atoi(os.Getenv("CLICKFLUSHINTERVALMS"))
+	envCacheSize, _ := strconv.Atoi(os.Getenv("CACHESIZE"))
+	envCacheTTLSeconds, _ := strconv.Atoi(os.Getenv("CACHETTLSECONDS"))
+	envBlocklistReloadSeconds, _ := strconv.Atoi(os.Getenv("BLOCKLISTRELOADSECONDS"))
+	envCreateRatePerMinute, _ := strconv.Atoi(os.Getenv("CREATERATEPERMINUTE"))
+	envCreateRateBurst, _ := strconv.Atoi(os.Getenv("CREATERATEBURST"))
+	envRedirectRatePerMinute, _ := strconv.Atoi(os.Getenv("REDIRECTRATEPERMINUTE"))
+	envRedirectRateBurst, _ := strconv.Atoi(os.Getenv("REDIRECTRATEBURST"))
+	envStatsRatePerMinute, _ := strconv.Atoi(os.Getenv("STATSRATEPERMINUTE"))
+	envStatsRateBurst, _ := strconv.Atoi(os.Getenv("STATSRATEBURST"))
+	envAuthRatePerMinute, _ := strconv.Atoi(os.Getenv("AUTHRATEPERMINUTE"))
+	envAuthRateBurst, _ := strconv.Atoi(os.Getenv("AUTHRATEBURST"))
 	cfg := &config{
 		DBDriverName:     os.Getenv("DBDRIVERNAME"),
 		ConnectionString: os.Getenv("DATABASE_URL"),
 		LogLevel:         os.Getenv("LOGLEVEL"),
 		Port:             envPort,
+		AdminPort:        envAdminPort,
 		WriteTimeout:     envWriteTimeout,
 		ReadTimeout:      envReadTimeout,
+
+		ShutdownDelaySeconds: envShutdownDelaySeconds,
+
+		DefaultTTLDays:    envDefaultTTLDays,
+		MaxTTLDays:        envMaxTTLDays,
+		AllowNeverExpires: envAllowNeverExpires,
+
+		StripTrackingParams: envStripTrackingParams,
+
+		DestinationAllow:       envList("DESTINATIONALLOW"),
+		DestinationDeny:        envList("DESTINATIONDENY"),
+		BlocklistFile:          os.Getenv("BLOCKLISTFILE"),
+		BlocklistReloadSeconds: envBlocklistReloadSeconds,
+		BlockPrivateIPs:        envBool("BLOCKPRIVATEIPS"),
+
+		GeoIPDatabase: os.Getenv("GEOIPDATABASE"),
+
+		JanitorIntervalMinutes: envJanitorIntervalMinutes,
+		JanitorBatchSize:       envJanitorBatchSize,
+		ClickRetentionDays:     envClickRetentionDays,
+		IdempotencyKeyTTLHours: envIdempotencyKeyTTLHours,
+
+		ClickQueueSize:       envClickQueueSize,
+		ClickBatchSize:       envClickBatchSize,
+		ClickFlushIntervalMs: envClickFlushIntervalMs,
+
+		CacheType:       os.Getenv("CACHETYPE"),
+		CacheSize:       envCacheSize,
+		CacheTTLSeconds: envCacheTTLSeconds,
+		RedisURL:        os.Getenv("REDIS_URL"),
+
+		AllowAnonymousCreate: envBool("ALLOWANONYMOUSCREATE"),
+		PublicForm:           envBool("PUBLICFORM"),
+
+		TrustedProxies: envList("TRUSTEDPROXIES"),
+
+		RateLimitStore:        os.Getenv("RATELIMITSTORE"),
+		RateLimitKey:          os.Getenv("RATELIMITKEY"),
+		CreateRatePerMinute:   envCreateRatePerMinute,
+		CreateRateBurst:       envCreateRateBurst,
+		RedirectRatePerMinute: envRedirectRatePerMinute,
+		RedirectRateBurst:     envRedirectRateBurst,
+		StatsRatePerMinute:    envStatsRatePerMinute,
+		StatsRateBurst:        envStatsRateBurst,
+		AuthRatePerMinute:     envAuthRatePerMinute,
+		AuthRateBurst:         envAuthRateBurst,
+
+		TracingExporter:    os.Getenv("TRACINGEXPORTER"),
+		TracingEndpoint:    os.Getenv("TRACINGENDPOINT"),
+		TracingFile:        os.Getenv("TRACINGFILE"),
+		TracingServiceName: os.Getenv("TRACINGSERVICENAME"),
 	}
 
 	fileCfg, err := readConfigFile(log, configPath)
@@ -104,6 +280,11 @@ func getConfig(log *logrus.Logger, configPath string) *config {
 		}
 	}
 
+	//without admin port metrics are served on main port
+	if cfg.AdminPort == 0 {
+		cfg.AdminPort = fileCfg.AdminPort
+	}
+
 	if cfg.ReadTimeout == 0 {
 		cfg.ReadTimeout = fileCfg.ReadTimeout
 		if cfg.ReadTimeout == 0 {
@@ -112,6 +293,11 @@ func getConfig(log *logrus.Logger, configPath string) *config {
 		}
 	}
 
+	//without delay server stops right after readiness starts failing
+	if cfg.ShutdownDelaySeconds == 0 {
+		cfg.ShutdownDelaySeconds = fileCfg.ShutdownDelaySeconds
+	}
+
 	if cfg.WriteTimeout == 0 {
 		cfg.WriteTimeout = fileCfg.WriteTimeout
 		if cfg.WriteTimeout == 0 {
@@ -120,11 +306,268 @@ func getConfig(log *logrus.Logger, configPath string) *config {
 		}
 	}
 
+	if cfg.DefaultTTLDays == 0 {
+		cfg.DefaultTTLDays = fileCfg.DefaultTTLDays
+		if cfg.DefaultTTLDays == 0 {
+			cfg.DefaultTTLDays = defaultDefaultTTLDays
+			log.Infof("DefaultTTLDays can't be 0. Default value %v is setted", defaultDefaultTTLDays)
+		}
+	}
+
+	if cfg.MaxTTLDays == 0 {
+		cfg.MaxTTLDays = fileCfg.MaxTTLDays
+	}
+	if cfg.MaxTTLDays != 0 && cfg.MaxTTLDays < cfg.DefaultTTLDays {
+		cfg.MaxTTLDays = cfg.DefaultTTLDays
+		log.Infof("MaxTTLDays can't be less than DefaultTTLDays. Value %v is setted", cfg.DefaultTTLDays)
+	}
+
+	if !cfg.AllowNeverExpires {
+		cfg.AllowNeverExpires = fileCfg.AllowNeverExpires
+	}
+
+	if !cfg.StripTrackingParams {
+		cfg.StripTrackingParams = fileCfg.StripTrackingParams
+	}
+
+	if len(cfg.DestinationAllow) == 0 {
+		cfg.DestinationAllow = fileCfg.DestinationAllow
+	}
+
+	if len(cfg.DestinationDeny) == 0 {
+		cfg.DestinationDeny = fileCfg.DestinationDeny
+	}
+
+	if cfg.BlocklistFile == "" {
+		cfg.BlocklistFile = fileCfg.BlocklistFile
+	}
+
+	if cfg.GeoIPDatabase == "" {
+		cfg.GeoIPDatabase = fileCfg.GeoIPDatabase
+	}
+
+	if cfg.BlocklistReloadSeconds == 0 {
+		cfg.BlocklistReloadSeconds = fileCfg.BlocklistReloadSeconds
+		if cfg.BlocklistReloadSeconds == 0 {
+			cfg.BlocklistReloadSeconds = defaultBlocklistReloadSeconds
+			log.Infof("BlocklistReloadSeconds can't be 0. Default value %v is setted", defaultBlocklistReloadSeconds)
+		}
+	}
+
+	if cfg.BlockPrivateIPs == nil {
+		cfg.BlockPrivateIPs = fileCfg.BlockPrivateIPs
+		if cfg.BlockPrivateIPs == nil {
+			value := defaultBlockPrivateIPs
+			cfg.BlockPrivateIPs = &value
+			log.Infof("BlockPrivateIPs isn't set. Default value %v is setted", defaultBlockPrivateIPs)
+		}
+	}
+
+	if cfg.JanitorIntervalMinutes == 0 {
+		cfg.JanitorIntervalMinutes = fileCfg.JanitorIntervalMinutes
+		if cfg.JanitorIntervalMinutes == 0 {
+			cfg.JanitorIntervalMinutes = defaultJanitorIntervalMinutes
+			log.Infof("JanitorIntervalMinutes can't be 0. Default value %v is setted", defaultJanitorIntervalMinutes)
+		}
+	}
+
+	if cfg.JanitorBatchSize == 0 {
+		cfg.JanitorBatchSize = fileCfg.JanitorBatchSize
+		if cfg.JanitorBatchSize == 0 {
+			cfg.JanitorBatchSize = defaultJanitorBatchSize
+			log.Infof("JanitorBatchSize can't be 0. Default value %v is setted", defaultJanitorBatchSize)
+		}
+	}
+
+	if cfg.ClickRetentionDays == 0 {
+		cfg.ClickRetentionDays = fileCfg.ClickRetentionDays
+	}
+
+	if cfg.IdempotencyKeyTTLHours == 0 {
+		cfg.IdempotencyKeyTTLHours = fileCfg.IdempotencyKeyTTLHours
+		if cfg.IdempotencyKeyTTLHours == 0 {
+			cfg.IdempotencyKeyTTLHours = defaultIdempotencyKeyTTLHours
+			log.Infof("IdempotencyKeyTTLHours can't be 0. Default value %v is setted", defaultIdempotencyKeyTTLHours)
+		}
+	}
+
+	if cfg.ClickQueueSize == 0 {
+		cfg.ClickQueueSize = fileCfg.ClickQueueSize
+		if cfg.ClickQueueSize == 0 {
+			cfg.ClickQueueSize = defaultClickQueueSize
+			log.Infof("ClickQueueSize can't be 0. Default value %v is setted", defaultClickQueueSize)
+		}
+	}
+
+	if cfg.ClickBatchSize == 0 {
+		cfg.ClickBatchSize = fileCfg.ClickBatchSize
+		if cfg.ClickBatchSize == 0 {
+			cfg.ClickBatchSize = defaultClickBatchSize
+			log.Infof("ClickBatchSize can't be 0. Default value %v is setted", defaultClickBatchSize)
+		}
+	}
+
+	if cfg.ClickFlushIntervalMs == 0 {
+		cfg.ClickFlushIntervalMs = fileCfg.ClickFlushIntervalMs
+		if cfg.ClickFlushIntervalMs == 0 {
+			cfg.ClickFlushIntervalMs = defaultClickFlushIntervalMs
+			log.Infof("ClickFlushIntervalMs can't be 0. Default value %v is setted", defaultClickFlushIntervalMs)
+		}
+	}
+
+	if cfg.CacheType == "" {
+		cfg.CacheType = fileCfg.CacheType
+	}
+
+	if cfg.CacheSize == 0 {
+		cfg.CacheSize = fileCfg.CacheSize
+		if cfg.CacheSize == 0 {
+			cfg.CacheSize = defaultCacheSize
+			log.Infof("CacheSize can't be 0. Default value %v is setted", defaultCacheSize)
+		}
+	}
+
+	if cfg.CacheTTLSeconds == 0 {
+		cfg.CacheTTLSeconds = fileCfg.CacheTTLSeconds
+		if cfg.CacheTTLSeconds == 0 {
+			cfg.CacheTTLSeconds = defaultCacheTTLSeconds
+			log.Infof("CacheTTLSeconds can't be 0. Default value %v is setted", defaultCacheTTLSeconds)
+		}
+	}
+
+	if cfg.RedisURL == "" {
+		cfg.RedisURL = fileCfg.RedisURL
+	}
+
+	if cfg.AllowAnonymousCreate == nil {
+		cfg.AllowAnonymousCreate = fileCfg.AllowAnonymousCreate
+		if cfg.AllowAnonymousCreate == nil {
+			value := defaultAllowAnonymousCreate
+			cfg.AllowAnonymousCreate = &value
+			log.Infof("AllowAnonymousCreate isn't set. Default value %v is setted", defaultAllowAnonymousCreate)
+		}
+	}
+
+	if cfg.PublicForm == nil {
+		cfg.PublicForm = fileCfg.PublicForm
+		if cfg.PublicForm == nil {
+			value := defaultPublicForm
+			cfg.PublicForm = &value
+			log.Infof("PublicForm isn't set. Default value %v is setted", defaultPublicForm)
+		}
+	}
+
+	if len(cfg.TrustedProxies) == 0 {
+		cfg.TrustedProxies = fileCfg.TrustedProxies
+	}
+
+	if cfg.RateLimitStore == "" {
+		cfg.RateLimitStore = fileCfg.RateLimitStore
+	}
+
+	if cfg.RateLimitKey == "" {
+		cfg.RateLimitKey = fileCfg.RateLimitKey
+		if cfg.RateLimitKey == "" {
+			cfg.RateLimitKey = defaultRateLimitKey
+			log.Infof("RateLimitKey can't be empty. Default value %v is setted", defaultRateLimitKey)
+		}
+	}
+
+	//negative rate turns limit of route class off
+	if cfg.CreateRatePerMinute == 0 {
+		cfg.CreateRatePerMinute = fileCfg.CreateRatePerMinute
+		if cfg.CreateRatePerMinute == 0 {
+			cfg.CreateRatePerMinute = defaultCreateRatePerMinute
+			log.Infof("CreateRatePerMinute can't be 0. Default value %v is setted", defaultCreateRatePerMinute)
+		}
+	}
+
+	if cfg.CreateRateBurst == 0 {
+		cfg.CreateRateBurst = fileCfg.CreateRateBurst
+	}
+
+	if cfg.RedirectRatePerMinute == 0 {
+		cfg.RedirectRatePerMinute = fileCfg.RedirectRatePerMinute
+		if cfg.RedirectRatePerMinute == 0 {
+			cfg.RedirectRatePerMinute = defaultRedirectRatePerMinute
+			log.Infof("RedirectRatePerMinute can't be 0. Default value %v is setted", defaultRedirectRatePerMinute)
+		}
+	}
+
+	if cfg.RedirectRateBurst == 0 {
+		cfg.RedirectRateBurst = fileCfg.RedirectRateBurst
+	}
+
+	if cfg.StatsRatePerMinute == 0 {
+		cfg.StatsRatePerMinute = fileCfg.StatsRatePerMinute
+		if cfg.StatsRatePerMinute == 0 {
+			cfg.StatsRatePerMinute = defaultStatsRatePerMinute
+			log.Infof("StatsRatePerMinute can't be 0. Default value %v is setted", defaultStatsRatePerMinute)
+		}
+	}
+
+	if cfg.StatsRateBurst == 0 {
+		cfg.StatsRateBurst = fileCfg.StatsRateBurst
+	}
+
+	if cfg.AuthRatePerMinute == 0 {
+		cfg.AuthRatePerMinute = fileCfg.AuthRatePerMinute
+		if cfg.AuthRatePerMinute == 0 {
+			cfg.AuthRatePerMinute = defaultAuthRatePerMinute
+			log.Infof("AuthRatePerMinute can't be 0. Default value %v is setted", defaultAuthRatePerMinute)
+		}
+	}
+
+	if cfg.AuthRateBurst == 0 {
+		cfg.AuthRateBurst = fileCfg.AuthRateBurst
+	}
+
+	if cfg.TracingExporter == "" {
+		cfg.TracingExporter = fileCfg.TracingExporter
+	}
+
+	if cfg.TracingEndpoint == "" {
+		cfg.TracingEndpoint = fileCfg.TracingEndpoint
+	}
+
+	if cfg.TracingFile == "" {
+		cfg.TracingFile = fileCfg.TracingFile
+	}
+
+	if cfg.TracingServiceName == "" {
+		cfg.TracingServiceName = fileCfg.TracingServiceName
+		if cfg.TracingServiceName == "" {
+			cfg.TracingServiceName = defaultTracingServiceName
+			log.Infof("TracingServiceName can't be empty. Default value %v is setted", defaultTracingServiceName)
+		}
+	}
+
 	log.Info("Settings loaded")
 
 	return cfg
 }
 
+//envBool returns value of boolean environment variable, nil if it's not set or invalid
+func envBool(name string) *bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
+//envList returns comma separated values of environment variable
+func envList(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func readConfigFile(log *logrus.Logger, configPath string) (*config, error) {
 
 	log.Info("reading config file")
@@ -185,15 +628,482 @@ func NewApp() *app {
 	return a
 }
 
+//Migrate runs migrate subcommand:
+//"up" applies pending migrations, "status" prints applied and pending ones
+func (a *app) Migrate(args []string) {
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	uss, err := usstorage.OpenUSStorage(a.log, a.config.DBDriverName, a.config.ConnectionString)
+	if err != nil {
+		a.log.Fatal(err)
+	}
+	defer uss.Close()
+
+	m, ok := uss.(usstorage.Migrator)
+	if !ok {
+		a.log.Fatalf("storage '%s' has no schema to migrate", a.config.DBDriverName)
+	}
+
+	switch command {
+	case "up":
+		applied, err := m.Migrate()
+		if err != nil {
+			a.log.Fatalf("migration failed after %d applied migrations: %v", applied, err)
+		}
+		fmt.Printf("%d migrations applied\n", applied)
+	case "status":
+		status, err := m.MigrationsStatus()
+		for _, m := range status {
+			if m.Applied {
+				fmt.Printf("%04d_%s\tapplied at %s\n", m.Version, m.Name, m.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("%04d_%s\tpending\n", m.Version, m.Name)
+			}
+		}
+		if err != nil {
+			a.log.Fatal(err)
+		}
+	default:
+		a.log.Fatalf("unknown migrate command '%s', use 'up' or 'status'", command)
+	}
+}
+
+//ApiKey runs apikey subcommand:
+//"create <name>" prints new api key, "list" prints all keys, "revoke <id>" revokes key
+func (a *app) ApiKey(args []string) {
+	uss, err := usstorage.NewUSStorage(a.log, a.config.DBDriverName, a.config.ConnectionString)
+	if err != nil {
+		a.log.Fatal(err)
+	}
+	defer uss.Close()
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{})
+	ctx := context.Background()
+
+	command := ""
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch {
+	case command == "create" && len(args) == 2:
+		key, err := us.CreateApiKey(ctx, args[1])
+		if err != nil {
+			a.log.Fatal(err)
+		}
+		fmt.Printf("api key %d '%s' created, it can't be shown again:\n%s\n", key.Id, key.Name, key.Key)
+	case command == "list" && len(args) == 1:
+		keys, err := us.ListApiKeys(ctx)
+		if err != nil {
+			a.log.Fatal(err)
+		}
+		for _, key := range keys {
+			status := "active"
+			if key.RevokedAt != "" {
+				status = "revoked at " + key.RevokedAt
+			}
+			fmt.Printf("%d\t%s\tcreated at %s\t%s\n", key.Id, key.Name, key.CreatedAt, status)
+		}
+	case command == "revoke" && len(args) == 2:
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			a.log.Fatalf("invalid api key id '%s'", args[1])
+		}
+		err = us.RevokeApiKey(ctx, id)
+		if err != nil {
+			a.log.Fatal(err)
+		}
+		fmt.Printf("api key %d revoked\n", id)
+	default:
+		a.log.Fatal("usage: apikey create <name> | apikey list | apikey revoke <id>")
+	}
+}
+
+//newCache creates cache of configured type, nil if cache is off
+func (a *app) newCache() cache.Cache {
+	switch a.config.CacheType {
+	case "":
+		a.log.Info("Cache is off")
+		return nil
+	case "lru":
+		a.log.Infof("Using in-process cache of %d links", a.config.CacheSize)
+		return cache.NewLRU(a.config.CacheSize)
+	case "redis":
+		r, err := cache.NewRedis(a.config.RedisURL, "urlshortener:", redisTimeout)
+		if err != nil {
+			a.log.Fatal("can't create redis cache ", err)
+		}
+		err = r.Ping()
+		if err != nil {
+			a.log.Errorf("redis is not available, got %v", err)
+		}
+		a.log.Info("Using redis cache")
+		return r
+	}
+
+	a.log.Fatalf("Unknown cache type '%s', use 'lru' or 'redis'", a.config.CacheType)
+	return nil
+}
+
+//newRateLimitStore creates rate limit store of configured type, nil if rate limiting is off
+func (a *app) newRateLimitStore() ratelimit.Store {
+	switch a.config.RateLimitStore {
+	case "":
+		a.log.Info("Rate limiting is off")
+		return nil
+	case "memory":
+		a.log.Info("Using in-process rate limits")
+		return ratelimit.NewMemory()
+	case "redis":
+		r, err := cache.NewRedis(a.config.RedisURL, "", redisTimeout)
+		if err != nil {
+			a.log.Fatal("can't create redis rate limit store ", err)
+		}
+		err = r.Ping()
+		if err != nil {
+			a.log.Errorf("redis is not available, got %v", err)
+		}
+		a.log.Info("Using redis rate limits")
+		return ratelimit.NewRedis(r, "urlshortener:ratelimit:")
+	}
+
+	a.log.Fatalf("Unknown rate limit store '%s', use 'memory' or 'redis'", a.config.RateLimitStore)
+	return nil
+}
+
+//newTracerProvider creates tracer provider exporting spans of configured exporter in batches, nil if tracing is off
+func (a *app) newTracerProvider() *sdktrace.TracerProvider {
+	var exporter sdktrace.SpanExporter
+	switch a.config.TracingExporter {
+	case "":
+		a.log.Info("Tracing is off")
+		return nil
+	case "otlp":
+		otlp, err := newOTLPExporter(a.config.TracingEndpoint)
+		if err != nil {
+			a.log.Fatal(err)
+		}
+		a.log.Infof("Exporting traces to %s", a.config.TracingEndpoint)
+		exporter = otlp
+	case "stdout":
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			a.log.Fatal(err)
+		}
+		a.log.Info("Writing traces to stdout")
+		exporter = stdout
+	case "file":
+		f, err := os.OpenFile(a.config.TracingFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			a.log.Fatalf("can't open traces file '%s', got %v", a.config.TracingFile, err)
+		}
+		file, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			a.log.Fatal(err)
+		}
+		a.log.Infof("Writing traces to %s", a.config.TracingFile)
+		exporter = file
+	default:
+		a.log.Fatalf("Unknown tracing exporter '%s', use 'otlp', 'stdout' or 'file'", a.config.TracingExporter)
+	}
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		a.log.Errorf("tracing error: %v", err)
+	}))
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter,
+			sdktrace.WithMaxQueueSize(tracingQueueSize),
+			sdktrace.WithMaxExportBatchSize(tracingBatchSize),
+			sdktrace.WithBatchTimeout(tracingFlushInterval),
+			sdktrace.WithExportTimeout(tracingExportTimeout)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(a.config.TracingServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(requestSampler{})),
+	)
+}
+
+//newOTLPExporter creates exporter sending spans with OTLP over HTTP to endpoint url,
+//endpoint without path gets the default /v1/traces
+func newOTLPExporter(endpoint string) (*otlptrace.Exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint '%s'", endpoint)
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host), otlptracehttp.WithTimeout(tracingExportTimeout)}
+	if u.Path != "" && u.Path != "/" {
+		options = append(options, otlptracehttp.WithURLPath(u.Path))
+	}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	return otlptracehttp.New(context.Background(), options...)
+}
+
+//requestSampler samples new traces of incoming requests only,
+//so spans of background jobs' queries don't start traces of their own
+type requestSampler struct{}
+
+func (requestSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	decision := sdktrace.Drop
+	if p.Kind == trace.SpanKindServer {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{Decision: decision, Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState()}
+}
+
+func (requestSampler) Description() string {
+	return "RequestSampler"
+}
+
+//registerMetrics exposes counters of application components in registry
+func registerMetrics(registry prometheus.Registerer, uss usstorage.Storage, cached *cache.Repo, us *usrepo.UrlShortener,
+	j *janitor.Janitor, clicks *clickqueue.Queue, destinations *policy.Policy) {
+
+	if cached != nil {
+		registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "urlshortener_redirect_cache_hits_total",
+			Help: "Links found in redirect cache.",
+		}, func() float64 {
+			return float64(cached.Stats().Hits)
+		}))
+		registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "urlshortener_redirect_cache_misses_total",
+			Help: "Links not found in redirect cache.",
+		}, func() float64 {
+			return float64(cached.Stats().Misses)
+		}))
+		registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "urlshortener_redirect_cache_hit_ratio",
+			Help: "Share of links found in redirect cache since start.",
+		}, func() float64 {
+			s := cached.Stats()
+			if s.Hits+s.Misses == 0 {
+				return 0
+			}
+			return float64(s.Hits) / float64(s.Hits+s.Misses)
+		}))
+	}
+
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "urlshortener_click_queue_depth",
+		Help: "Clicks waiting in queue to be saved.",
+	}, func() float64 {
+		return float64(clicks.Stats().Depth)
+	}))
+	registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "urlshortener_click_queue_dropped_total",
+		Help: "Clicks dropped because queue was full.",
+	}, func() float64 {
+		return float64(clicks.Stats().Dropped)
+	}))
+	registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "urlshortener_click_queue_failed_total",
+		Help: "Clicks which couldn't be saved.",
+	}, func() float64 {
+		return float64(clicks.Stats().Failed)
+	}))
+
+	if pool, ok := uss.(usstorage.Pool); ok {
+		registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "urlshortener_db_open_connections",
+			Help: "Established connections to database.",
+		}, func() float64 {
+			return float64(pool.PoolStats().OpenConnections)
+		}))
+		registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "urlshortener_db_in_use_connections",
+			Help: "Connections to database currently in use.",
+		}, func() float64 {
+			return float64(pool.PoolStats().InUse)
+		}))
+		registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "urlshortener_db_idle_connections",
+			Help: "Idle connections to database.",
+		}, func() float64 {
+			return float64(pool.PoolStats().Idle)
+		}))
+		registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "urlshortener_db_max_open_connections",
+			Help: "Maximum number of open connections to database.",
+		}, func() float64 {
+			return float64(pool.PoolStats().MaxOpenConnections)
+		}))
+		registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "urlshortener_db_wait_count_total",
+			Help: "Times connection to database was waited for.",
+		}, func() float64 {
+			return float64(pool.PoolStats().WaitCount)
+		}))
+		registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "urlshortener_db_wait_duration_seconds_total",
+			Help: "Time spent waiting for connections to database.",
+		}, func() float64 {
+			return pool.PoolStats().WaitDuration.Seconds()
+		}))
+	}
+
+	registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "urlshortener_links_created_total",
+		Help: "Short links created.",
+	}, func() float64 {
+		return float64(us.Stats().LinksCreated)
+	}))
+	registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "urlshortener_links_expired_total",
+		Help: "Expired short links deleted by janitor.",
+	}, func() float64 {
+		return float64(j.Stats().DeletedUrls)
+	}))
+	registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "urlshortener_links_blocked_total",
+		Help: "Destinations rejected by destination policy.",
+	}, func() float64 {
+		return float64(destinations.Stats().Blocked)
+	}))
+}
+
+//newHealthChecker checks storage, its schema and cache before instance is told to be ready
+func newHealthChecker(uss usstorage.Storage, linkCache cache.Cache) *health.Checker {
+	checker := health.NewChecker(readinessTimeout)
+
+	if p, ok := uss.(usstorage.Pinger); ok {
+		checker.Add("database", p.Ping)
+	}
+
+	if m, ok := uss.(usstorage.Migrator); ok {
+		checker.Add("migrations", func(ctx context.Context) error {
+			status, err := m.MigrationsStatus()
+			if err != nil {
+				return err
+			}
+			pending := 0
+			for _, s := range status {
+				if !s.Applied {
+					pending++
+				}
+			}
+			if pending > 0 {
+				return fmt.Errorf("%d migrations are pending", pending)
+			}
+			return nil
+		})
+	}
+
+	if p, ok := linkCache.(interface{ Ping() error }); ok {
+		checker.Add("cache", func(ctx context.Context) error {
+			return p.Ping()
+		})
+	}
+
+	return checker
+}
+
 //Run initializes storage and runs application
 func (a *app) Run() {
 
-	uss := usstorage.NewUSStorage(a.log, a.config.DBDriverName, a.config.ConnectionString)
-	us := usrepo.NewUrlShortener(uss)
+	uss, err := usstorage.NewUSStorage(a.log, a.config.DBDriverName, a.config.ConnectionString)
+	if err != nil {
+		a.log.Fatal(err)
+	}
+	var repo usrepo.UrlShortenerRepo = uss
+	var cached *cache.Repo
+	linkCache := a.newCache()
+	if linkCache != nil {
+		defer linkCache.Close()
+		cached = cache.NewRepo(a.log, uss, linkCache, time.Duration(a.config.CacheTTLSeconds)*time.Second)
+		repo = cached
+	}
+
+	destinations, err := policy.NewPolicy(a.log, policy.Config{
+		Allow:           a.config.DestinationAllow,
+		Deny:            a.config.DestinationDeny,
+		BlocklistFile:   a.config.BlocklistFile,
+		ReloadInterval:  time.Duration(a.config.BlocklistReloadSeconds) * time.Second,
+		BlockPrivateIPs: *a.config.BlockPrivateIPs,
+	}, nil)
+	if err != nil {
+		a.log.Fatal(err)
+	}
+	destinations.Start()
+
+	var geo usrepo.GeoLocator
+	if a.config.GeoIPDatabase != "" {
+		locator, err := geoip.Open(a.log, a.config.GeoIPDatabase)
+		if err != nil {
+			a.log.Fatal(err)
+		}
+		defer locator.Close()
+		geo = locator
+	}
+
+	us := usrepo.NewUrlShortener(repo, usrepo.Config{
+		DefaultTTL:          time.Duration(a.config.DefaultTTLDays) * 24 * time.Hour,
+		MaxTTL:              time.Duration(a.config.MaxTTLDays) * 24 * time.Hour,
+		AllowNeverExpires:   a.config.AllowNeverExpires,
+		StripTrackingParams: a.config.StripTrackingParams,
+		Policy:              destinations,
+		Geo:                 geo,
+	})
 	defer uss.Close()
 
 	a.us = us
-	router := handler.NewHandler(a.log, us)
+
+	j := janitor.NewJanitor(a.log, uss, janitor.Config{
+		Interval:          time.Duration(a.config.JanitorIntervalMinutes) * time.Minute,
+		ClickRetention:    time.Duration(a.config.ClickRetentionDays) * 24 * time.Hour,
+		IdempotencyKeyTTL: time.Duration(a.config.IdempotencyKeyTTLHours) * time.Hour,
+		BatchSize:         a.config.JanitorBatchSize,
+	})
+	j.Start()
+
+	clicks := clickqueue.NewQueue(a.log, us, clickqueue.Config{
+		Size:          a.config.ClickQueueSize,
+		BatchSize:     a.config.ClickBatchSize,
+		FlushInterval: time.Duration(a.config.ClickFlushIntervalMs) * time.Millisecond,
+	})
+	clicks.Start()
+
+	realIP, err := realip.NewResolver(a.config.TrustedProxies)
+	if err != nil {
+		a.log.Fatal(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	registerMetrics(registry, uss, cached, us, j, clicks, destinations)
+
+	checker := newHealthChecker(uss, linkCache)
+
+	var tracer trace.TracerProvider
+	tracerProvider := a.newTracerProvider()
+	if tracerProvider != nil {
+		otel.SetTracerProvider(tracerProvider)
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+		tracer = tracerProvider
+	}
+
+	router := handler.NewHandler(a.log, us, clicks, handler.Config{
+		AllowAnonymousCreate: *a.config.AllowAnonymousCreate,
+		PublicForm:           *a.config.PublicForm,
+		RateLimit: handler.RateLimitConfig{
+			Store:    a.newRateLimitStore(),
+			Create:   ratelimit.Limit{Requests: a.config.CreateRatePerMinute, Period: time.Minute, Burst: a.config.CreateRateBurst},
+			Redirect: ratelimit.Limit{Requests: a.config.RedirectRatePerMinute, Period: time.Minute, Burst: a.config.RedirectRateBurst},
+			Stats:    ratelimit.Limit{Requests: a.config.StatsRatePerMinute, Period: time.Minute, Burst: a.config.StatsRateBurst},
+			Auth:     ratelimit.Limit{Requests: a.config.AuthRatePerMinute, Period: time.Minute, Burst: a.config.AuthRateBurst},
+			KeyBy:    a.config.RateLimitKey,
+		},
+		RealIP:       realIP,
+		Metrics:      registry,
+		ServeMetrics: a.config.AdminPort == 0,
+		Health:       checker,
+		Tracer:       tracer,
+	})
 
 	srv := &http.Server{
 		Handler:      router,
@@ -204,20 +1114,67 @@ func (a *app) Run() {
 
 	go func() {
 		a.log.Infof("App is starting on port: %v", a.config.Port)
-		a.log.Fatal(srv.ListenAndServe())
+		//Shutdown makes ListenAndServe return at once, clicks are still being drained then
+		err := srv.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			a.log.Fatal(err)
+		}
 	}()
 
+	var admin *http.Server
+	if a.config.AdminPort != 0 {
+		adminRouter := http.NewServeMux()
+		adminRouter.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		admin = &http.Server{
+			Handler:      adminRouter,
+			Addr:         ":" + strconv.Itoa(a.config.AdminPort),
+			WriteTimeout: time.Duration(a.config.WriteTimeout) * time.Second,
+			ReadTimeout:  time.Duration(a.config.ReadTimeout) * time.Second,
+		}
+
+		go func() {
+			a.log.Infof("Admin endpoints are starting on port: %v", a.config.AdminPort)
+			err := admin.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				a.log.Fatal(err)
+			}
+		}()
+	}
+
 	c := make(chan os.Signal, 1)
 
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
 
+	//load balancers see failing readiness and stop sending requests before server stops accepting them
+	checker.ShutDown()
+	if a.config.ShutdownDelaySeconds > 0 {
+		a.log.Infof("draining traffic for %d seconds", a.config.ShutdownDelaySeconds)
+		time.Sleep(time.Duration(a.config.ShutdownDelaySeconds) * time.Second)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.config.ReadTimeout+a.config.WriteTimeout)*time.Second)
 	defer cancel()
-	err := srv.Shutdown(ctx)
+	//errors are logged rather than fatal so that deferred closes still run
+	err = srv.Shutdown(ctx)
 	if err != nil {
-		log.Fatal("err while shutting down", err)
+		a.log.Errorf("err while shutting down, got %v", err)
+	}
+	if admin != nil {
+		err = admin.Shutdown(ctx)
+		if err != nil {
+			a.log.Errorf("err while shutting down admin server, got %v", err)
+		}
+	}
+	//handlers are finished, no more clicks are coming
+	clicks.Stop()
+	j.Stop()
+	destinations.Stop()
+	if tracerProvider != nil {
+		err = tracerProvider.Shutdown(ctx)
+		if err != nil {
+			a.log.Errorf("can't export remaining spans, got %v", err)
+		}
 	}
 	a.log.Info("shutting down")
-	os.Exit(0)
 }
@@ -1,8 +1,21 @@
 package main
 
-import "urlshortener/cmd/app"
+import (
+	"flag"
+	//time zones of stats are available without system database
+	_ "time/tzdata"
+
+	"urlshortener/cmd/app"
+)
 
 func main() {
 	app := app.NewApp()
-	app.Run()
+	switch flag.Arg(0) {
+	case "migrate":
+		app.Migrate(flag.Args()[1:])
+	case "apikey":
+		app.ApiKey(flag.Args()[1:])
+	default:
+		app.Run()
+	}
 }
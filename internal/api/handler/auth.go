@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"urlshortener/internal/models"
+	"urlshortener/internal/repos/usrepo"
+)
+
+type contextKey int
+
+const (
+	apiKeyContextKey contextKey = iota
+	clientIPContextKey
+)
+
+//AuthMiddleware authenticates requests with "Authorization: Bearer <api key>" header
+//and puts api key into request context. Requests without header pass as anonymous,
+//requests with invalid or revoked key are rejected
+func AuthMiddleware(logger *logrus.Logger, repo *usrepo.UrlShortener) func(http.Handler) http.Handler {
+	h := &Handler{log: logger}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			const prefix = "Bearer "
+			if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				h.writeError(w, fmt.Errorf("%w: Authorization header must be 'Bearer <api key>'", models.ErrUnauthorized))
+				return
+			}
+
+			key, err := repo.Authenticate(r.Context(), strings.TrimSpace(header[len(prefix):]))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				h.writeError(w, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+//RequireKeyMiddleware rejects anonymous requests, it must go after AuthMiddleware
+func RequireKeyMiddleware(logger *logrus.Logger) func(http.Handler) http.Handler {
+	h := &Handler{log: logger}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if apiKeyFromContext(r.Context()) == nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				h.writeError(w, models.ErrApiKeyRequired)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+//apiKeyFromContext returns api key of authenticated request, nil for anonymous one
+func apiKeyFromContext(ctx context.Context) *models.ApiKeyScheme {
+	key, _ := ctx.Value(apiKeyContextKey).(*models.ApiKeyScheme)
+	return key
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	usstorage "urlshortener/internal/db"
+	"urlshortener/internal/repos/usrepo"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{})
+	key, err := us.CreateApiKey(ctx, "ci")
+	assert.NoError(t, err)
+
+	var owner int64
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		owner = 0
+		if key := apiKeyFromContext(r.Context()); key != nil {
+			owner = key.Id
+		}
+	})
+	open := AuthMiddleware(log, us)(next)
+	locked := AuthMiddleware(log, us)(RequireKeyMiddleware(log)(next))
+
+	cases := []struct {
+		handler http.Handler
+		header  string
+		status  int
+		owner   int64
+	}{
+		{open, "", http.StatusOK, 0},
+		{open, "Bearer " + key.Key, http.StatusOK, key.Id},
+		{open, "Basic " + key.Key, http.StatusUnauthorized, 0},
+		{open, "Bearer us_wrong", http.StatusUnauthorized, 0},
+		{locked, "", http.StatusUnauthorized, 0},
+		{locked, "bearer " + key.Key, http.StatusOK, key.Id},
+	}
+
+	for _, c := range cases {
+		owner = 0
+		r := httptest.NewRequest(http.MethodPost, "/generate", nil)
+		if c.header != "" {
+			r.Header.Set("Authorization", c.header)
+		}
+		w := httptest.NewRecorder()
+		c.handler.ServeHTTP(w, r)
+
+		assert.Equal(t, c.status, w.Code, c.header)
+		assert.Equal(t, c.owner, owner, c.header)
+		if c.status == http.StatusUnauthorized {
+			assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	assert.NoError(t, us.RevokeApiKey(ctx, key.Id))
+	r := httptest.NewRequest(http.MethodPost, "/generate", nil)
+	r.Header.Set("Authorization", "Bearer "+key.Key)
+	w := httptest.NewRecorder()
+	open.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"urlshortener/internal/models"
+)
+
+const (
+	contentTypeJSON   = "application/json"
+	contentTypeNDJSON = "application/x-ndjson"
+	contentTypeCSV    = "text/csv"
+)
+
+//bulkBodyLimit limits size of bulk request body
+const bulkBodyLimit = 32 << 20
+
+//bulkFlushRows is a number of result rows sent to client at once
+const bulkFlushRows = 100
+
+//csvColumns are columns of bulk CSV request, header row with their names is required
+var csvColumns = map[string]bool{
+	"url":            true,
+	"alias":          true,
+	"ttl":            true,
+	"expirationdate": true,
+	"neverexpires":   true,
+}
+
+var csvResultHeader = []string{"row", "shortId", "statId", "fullUrl", "expirationDate", "errorCode", "errorMessage"}
+
+//bulkGenerate creates links from JSON array, NDJSON or CSV body in one transaction.
+//Results are written in the same format as request, one row per requested link
+func (h *Handler) bulkGenerate(w http.ResponseWriter, r *http.Request) {
+	h.log.Info("HandlerBulkGenerate")
+
+	format, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		format = contentTypeJSON
+	}
+
+	body := http.MaxBytesReader(w, r.Body, bulkBodyLimit)
+	var urls []models.FullUrlScheme
+	var rowErrors []error
+	switch format {
+	case contentTypeCSV:
+		urls, rowErrors, err = readCSVUrls(body)
+	case contentTypeNDJSON:
+		urls, err = readNDJSONUrls(body)
+	case contentTypeJSON:
+		err = json.NewDecoder(body).Decode(&urls)
+	default:
+		err = fmt.Errorf("content type must be %s, %s or %s", contentTypeJSON, contentTypeNDJSON, contentTypeCSV)
+	}
+	if err != nil {
+		h.writeError(w, fmt.Errorf("%w: %v", models.ErrInvalidInput, err))
+		return
+	}
+	if rowErrors == nil {
+		rowErrors = make([]error, len(urls))
+	}
+
+	owner := int64(0)
+	if key := apiKeyFromContext(r.Context()); key != nil {
+		owner = key.Id
+	}
+
+	//rows failed to parse don't go to repo, positions keeps places of the others
+	valid := make([]models.FullUrlScheme, 0, len(urls))
+	positions := make([]int, 0, len(urls))
+	for i, url := range urls {
+		if rowErrors[i] != nil {
+			continue
+		}
+		url.OwnerKeyId = owner
+		valid = append(valid, url)
+		positions = append(positions, i)
+	}
+
+	results := make([]models.GenerateResult, len(urls))
+	for i, err := range rowErrors {
+		results[i].Err = err
+	}
+	if len(valid) > 0 || len(urls) == 0 {
+		created, err := h.repo.GenerateShortUrls(r.Context(), valid)
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+		for i, result := range created {
+			results[positions[i]] = result
+		}
+	}
+
+	h.writeBulkResults(w, format, results)
+}
+
+//writeBulkResults writes results flushing them by portions
+func (h *Handler) writeBulkResults(w http.ResponseWriter, format string, results []models.GenerateResult) {
+	flusher, _ := w.(http.Flusher)
+	var csvWriter *csv.Writer
+	encoder := json.NewEncoder(w)
+
+	w.Header().Set("Content-Type", format)
+	w.WriteHeader(http.StatusOK)
+
+	switch format {
+	case contentTypeCSV:
+		csvWriter = csv.NewWriter(w)
+		csvWriter.Write(csvResultHeader)
+	case contentTypeJSON:
+		io.WriteString(w, "[")
+	}
+
+	failed := 0
+	for i, result := range results {
+		row := models.BulkRowScheme{Row: i + 1, ShortLinkScheme: result.Data}
+		if result.Err != nil {
+			_, errorScheme := h.errorScheme(result.Err)
+			row.Error = &errorScheme
+			failed++
+		}
+
+		var err error
+		switch format {
+		case contentTypeCSV:
+			err = csvWriter.Write(csvResultRow(row))
+		case contentTypeJSON:
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			err = encoder.Encode(row)
+		default:
+			err = encoder.Encode(row)
+		}
+		if err != nil {
+			h.log.Error(err)
+			return
+		}
+
+		if (i+1)%bulkFlushRows == 0 {
+			if csvWriter != nil {
+				csvWriter.Flush()
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	switch format {
+	case contentTypeCSV:
+		csvWriter.Flush()
+	case contentTypeJSON:
+		io.WriteString(w, "]")
+	}
+
+	h.log.Infof("bulk generate: %d links created, %d failed", len(results)-failed, failed)
+}
+
+func csvResultRow(row models.BulkRowScheme) []string {
+	record := make([]string, len(csvResultHeader))
+	record[0] = strconv.Itoa(row.Row)
+	if row.ShortLinkScheme != nil {
+		record[1] = row.ShortId
+		record[2] = row.StatId
+		record[3] = row.FullUrl
+		record[4] = row.ExpirationDate
+	}
+	if row.Error != nil {
+		record[5] = row.Error.Code
+		record[6] = row.Error.Message
+	}
+
+	return record
+}
+
+//readNDJSONUrls reads one link per line
+func readNDJSONUrls(r io.Reader) ([]models.FullUrlScheme, error) {
+	var urls []models.FullUrlScheme
+	decoder := json.NewDecoder(r)
+	for {
+		var url models.FullUrlScheme
+		err := decoder.Decode(&url)
+		if err == io.EOF {
+			return urls, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", len(urls)+1, err)
+		}
+		urls = append(urls, url)
+	}
+}
+
+//readCSVUrls reads links from CSV with header row.
+//Malformed CSV fails the whole request, invalid values fail their rows only
+func readCSVUrls(r io.Reader) ([]models.FullUrlScheme, []error, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !csvColumns[name] {
+			return nil, nil, fmt.Errorf("unknown CSV column '%s'", header[i])
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, nil, fmt.Errorf("CSV column 'url' is required")
+	}
+
+	var urls []models.FullUrlScheme
+	var rowErrors []error
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return urls, rowErrors, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		url, err := csvUrl(record, columns)
+		urls = append(urls, url)
+		rowErrors = append(rowErrors, err)
+	}
+}
+
+func csvUrl(record []string, columns map[string]int) (url models.FullUrlScheme, err error) {
+	value := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	url = models.FullUrlScheme{
+		Url:            value("url"),
+		Alias:          value("alias"),
+		ExpirationDate: value("expirationdate"),
+	}
+
+	if ttl := value("ttl"); ttl != "" {
+		url.TTL, err = strconv.ParseInt(ttl, 10, 64)
+		if err != nil {
+			return url, fmt.Errorf("%w: TTL must be a number of seconds", models.ErrInvalidExpiration)
+		}
+	}
+
+	if neverExpires := value("neverexpires"); neverExpires != "" {
+		url.NeverExpires, err = strconv.ParseBool(neverExpires)
+		if err != nil {
+			return url, fmt.Errorf("%w: neverExpires must be true or false", models.ErrInvalidExpiration)
+		}
+	}
+
+	return url, nil
+}
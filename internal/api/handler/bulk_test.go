@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/clickqueue"
+	usstorage "urlshortener/internal/db"
+	"urlshortener/internal/models"
+	"urlshortener/internal/repos/usrepo"
+)
+
+func TestBulkGenerate(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{AllowNeverExpires: true})
+	clicks := clickqueue.NewQueue(log, uss, clickqueue.Config{Size: 10, BatchSize: 10})
+	router := NewHandler(log, us, clicks, Config{AllowAnonymousCreate: true})
+
+	post := func(contentType string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/v1/links/bulk", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := post("application/json", `[{"Url": "http://yandex.ru", "Alias": "json"}, {"Url": "bad"}, {"Url": "http://ya.ru", "Alias": "json"}]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rows []models.BulkRowScheme
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rows))
+	assert.Len(t, rows, 3)
+	assert.Equal(t, "json", rows[0].ShortId)
+	assert.Equal(t, "invalid_input", rows[1].Error.Code)
+	assert.Equal(t, 3, rows[2].Row)
+	assert.Equal(t, "conflict", rows[2].Error.Code)
+
+	w = post("application/x-ndjson; charset=utf-8", "{\"Url\": \"http://yandex.ru\"}\n{\"Url\": \"http://ya.ru\", \"NeverExpires\": true}\n")
+	assert.Equal(t, http.StatusOK, w.Code)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 2)
+	var row models.BulkRowScheme
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &row))
+	assert.Nil(t, row.Error)
+	assert.Equal(t, "", row.ExpirationDate)
+
+	w = post("text/csv", "url,alias,ttl\nhttp://yandex.ru,csv,60\nhttp://ya.ru,,minute\n")
+	assert.Equal(t, http.StatusOK, w.Code)
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, csvResultHeader, records[0])
+	assert.Equal(t, "csv", records[1][1])
+	assert.Equal(t, "", records[1][5])
+	assert.Equal(t, "invalid_input", records[2][5])
+
+	fus, err := us.GetFullUrl(ctx, "csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://yandex.ru/", fus.Url)
+
+	assert.Equal(t, http.StatusBadRequest, post("text/csv", "destination\nhttp://yandex.ru\n").Code)
+	assert.Equal(t, http.StatusBadRequest, post("application/x-ndjson", "{\"Url\": \n").Code)
+	assert.Equal(t, http.StatusBadRequest, post("application/json", "[]").Code)
+	assert.Equal(t, http.StatusBadRequest, post("text/plain", "http://yandex.ru").Code)
+}
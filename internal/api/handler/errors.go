@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"urlshortener/internal/models"
+)
+
+//errorKinds maps error kinds to response status and code, errors of other kinds are internal
+var errorKinds = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{models.ErrInvalidInput, http.StatusBadRequest, "invalid_input"},
+	{models.ErrUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{models.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{models.ErrNotFound, http.StatusNotFound, "not_found"},
+	{models.ErrConflict, http.StatusConflict, "conflict"},
+	{models.ErrExpired, http.StatusGone, "expired"},
+	{models.ErrTooManyRequests, http.StatusTooManyRequests, "rate_limited"},
+}
+
+//writeError writes error response with status and JSON body depending on error kind.
+//Internal errors' details are logged but not sent to the client
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	status, body := h.errorScheme(err)
+	h.writeJSON(w, status, body)
+}
+
+//errorScheme returns response status and body for error depending on its kind
+func (h *Handler) errorScheme(err error) (int, models.ErrorScheme) {
+	status := http.StatusInternalServerError
+	body := models.ErrorScheme{
+		Code:    "internal",
+		Message: models.ErrInternal.Error(),
+	}
+
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.err) {
+			status = kind.status
+			body = models.ErrorScheme{
+				Code:    kind.code,
+				Message: err.Error(),
+			}
+			break
+		}
+	}
+
+	if status == http.StatusInternalServerError {
+		h.log.Error(err)
+	} else {
+		h.log.Info(err)
+	}
+
+	return status, body
+}
+
+//writeJSON writes value as JSON response with given status
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		h.log.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	answer := string(bytes)
+
+	h.log.Debug(answer)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprint(w, answer)
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/models"
+)
+
+func TestWriteError(t *testing.T) {
+	h := &Handler{log: logrus.New()}
+
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("generate short url error: %w", models.ErrInvalidAlias), http.StatusBadRequest, "invalid_input"},
+		{fmt.Errorf("get full url error: %w", models.ErrLinkNotFound), http.StatusNotFound, "not_found"},
+		{models.ErrInvalidApiKey, http.StatusUnauthorized, "unauthorized"},
+		{models.ErrLinkAccessDenied, http.StatusForbidden, "forbidden"},
+		{fmt.Errorf("generate short url error: %w", models.ErrDestinationBlocked), http.StatusForbidden, "forbidden"},
+		{models.ErrAliasTaken, http.StatusConflict, "conflict"},
+		{models.ErrLinkExpired, http.StatusGone, "expired"},
+		{models.ErrRateLimited, http.StatusTooManyRequests, "rate_limited"},
+		{errors.New("database is locked"), http.StatusInternalServerError, "internal"},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		h.writeError(w, c.err)
+
+		var body models.ErrorScheme
+		err := json.Unmarshal(w.Body.Bytes(), &body)
+		assert.NoError(t, err)
+		assert.Equal(t, c.status, w.Code)
+		assert.Equal(t, c.code, body.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	}
+
+	w := httptest.NewRecorder()
+	h.writeError(w, errors.New("database is locked"))
+	assert.NotContains(t, w.Body.String(), "locked")
+}
@@ -23,6 +23,10 @@ func (h *Handler) front(w http.ResponseWriter, r *http.Request) {
 				<label for="url" class="col-form-label">Ссылка:</label>
 				<input type="url" name="url" class="form-control" id="url" placeholder="Url">
 			  </div>
+			<div class="col-md-6 mb-3">
+				<label for="alias" class="col-form-label">Псевдоним (необязательно):</label>
+				<input type="text" name="alias" class="form-control" id="alias" placeholder="my-link" pattern="[A-Za-z0-9_\-]{3,64}">
+			  </div>
 			<button type="submit" class="btn btn-primary">Отправить</button>
 		  </form>
 		</div>
@@ -38,12 +42,15 @@ func (h *Handler) front(w http.ResponseWriter, r *http.Request) {
 			result.append(ul)
 		  }
 	
-		  const handler = (link) => {
+		  const handler = (link, alias) => {
 			//const path = 'http://httpbin.org/post';
 			const path = 'https://urlshortenerrr.herokuapp.com/generate';
 			const loc = window.location.origin;
 			console.log(loc);
 			const data = { url: link };
+			if (alias) {
+			  data.alias = alias;
+			}
 			  fetch(path, {
 				method: 'POST',
 				body: JSON.stringify(data),
@@ -83,7 +90,8 @@ func (h *Handler) front(w http.ResponseWriter, r *http.Request) {
 			e.preventDefault();
 			const formData = new FormData(e.target);
 			const url = formData.get('url').trim();
-			handler(url);
+			const alias = formData.get('alias').trim();
+			handler(url, alias);
 		  })
 		</script>
 	
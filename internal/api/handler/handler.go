@@ -3,44 +3,111 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
-	"net"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
+	"urlshortener/internal/clickqueue"
+	"urlshortener/internal/health"
 	"urlshortener/internal/models"
+	"urlshortener/internal/realip"
 	"urlshortener/internal/repos/usrepo"
+	"urlshortener/internal/useragent"
 
 	"github.com/rs/cors"
 )
 
-func NewHandler(log *logrus.Logger, repo *usrepo.UrlShortener) http.Handler {
+//Config holds access settings of http api.
+//Requests are traced when Tracer is set, callers' traces are found by Propagator or the global one of OpenTelemetry
+type Config struct {
+	AllowAnonymousCreate bool
+	PublicForm           bool
+	RateLimit            RateLimitConfig
+	RealIP               *realip.Resolver
+	Metrics              *prometheus.Registry
+	ServeMetrics         bool
+	Health               *health.Checker
+	Tracer               trace.TracerProvider
+	Propagator           propagation.TextMapPropagator
+}
+
+func NewHandler(log *logrus.Logger, repo *usrepo.UrlShortener, clicks *clickqueue.Queue, cfg Config) http.Handler {
 	router := mux.NewRouter()
 
-	handler := &Handler{log: log, repo: repo}
-	router.HandleFunc("/generate", handler.generate).Methods("POST")
+	handler := &Handler{log: log, repo: repo, clicks: clicks, health: cfg.Health}
 
-	router.HandleFunc("/stat/{statid}", handler.stat).Methods("GET")
+	create := router.NewRoute().Subrouter()
+	create.Use(RateLimitMiddleware(log, cfg.RateLimit, rateClassCreate, cfg.RateLimit.Create))
+	if !cfg.AllowAnonymousCreate {
+		create.Use(RequireKeyMiddleware(log))
+	}
+	create.HandleFunc("/generate", handler.generate).Methods("POST")
+	create.HandleFunc("/api/v1/links/bulk", handler.bulkGenerate).Methods("POST")
+
+	statsLimit := RateLimitMiddleware(log, cfg.RateLimit, rateClassStats, cfg.RateLimit.Stats)
+
+	stats := router.NewRoute().Subrouter()
+	stats.Use(statsLimit)
+	stats.HandleFunc("/stat/{statid}", handler.stat).Methods("GET")
+
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Use(statsLimit)
+	api.HandleFunc("/links", handler.listLinks).Methods("GET")
+	api.HandleFunc("/links/{id}", handler.getLink).Methods("GET")
+	api.HandleFunc("/links/{id}", handler.updateLink).Methods("PATCH")
+	api.HandleFunc("/links/{id}", handler.deleteLink).Methods("DELETE")
+
+	//registered before short links so they aren't taken for short ids
+	router.HandleFunc("/healthz", handler.healthz).Methods("GET")
+	router.HandleFunc("/readyz", handler.readyz).Methods("GET")
+	if cfg.Metrics != nil && cfg.ServeMetrics {
+		router.Handle("/metrics", promhttp.HandlerFor(cfg.Metrics, promhttp.HandlerOpts{})).Methods("GET")
+	}
 
-	router.HandleFunc("/{shorturl}", handler.redirect).Methods("GET")
+	redirect := router.NewRoute().Subrouter()
+	redirect.Use(RateLimitMiddleware(log, cfg.RateLimit, rateClassRedirect, cfg.RateLimit.Redirect))
+	redirect.HandleFunc("/{shorturl}", handler.redirect).Methods("GET")
 
 	router.HandleFunc("/heart/beat", handler.heartbeat).Methods("GET")
 
-	router.HandleFunc("/", handler.front).Methods("GET")
+	if cfg.PublicForm {
+		router.HandleFunc("/", handler.front).Methods("GET")
+	}
 
-	CorsHandler := cors.Default().Handler(router)
+	corsHandler := cors.New(cors.Options{
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodHead, http.MethodPatch, http.MethodDelete},
+		AllowedHeaders: []string{"Content-Type", "Authorization", statIdHeader, idempotencyKeyHeader},
+		ExposedHeaders: []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+	})
+	CorsHandler := corsHandler.Handler(router)
 	loggingMiddleware := LoggingMiddleware(log)
 
+	if cfg.Metrics != nil {
+		router.Use(MetricsMiddleware(cfg.Metrics))
+	}
+	router.Use(TracingMiddleware(cfg.Tracer, cfg.Propagator))
 	router.Use(loggingMiddleware)
+	router.Use(RealIPMiddleware(log, cfg.RealIP))
+	router.Use(AuthRateLimitMiddleware(log, cfg.RateLimit))
+	router.Use(AuthMiddleware(log, repo))
 
 	return CorsHandler
 }
 
+//idempotencyKeyHeader makes client's retries of /generate return link created by the first request
+const idempotencyKeyHeader = "Idempotency-Key"
+
 type Handler struct {
-	log  *logrus.Logger
-	repo *usrepo.UrlShortener
+	log    *logrus.Logger
+	repo   *usrepo.UrlShortener
+	clicks *clickqueue.Queue
+	health *health.Checker
 }
 
 func (h *Handler) heartbeat(w http.ResponseWriter, r *http.Request) {
@@ -54,104 +121,110 @@ func (h *Handler) generate(w http.ResponseWriter, r *http.Request) {
 	var urlData models.FullUrlScheme
 	err := json.NewDecoder(r.Body).Decode(&urlData)
 	if err != nil {
-		h.log.Error(err)
-		fmt.Fprint(w, err)
+		h.writeError(w, fmt.Errorf("%w: %v", models.ErrInvalidInput, err))
 		return
 	}
 
-	data, err := h.repo.GenerateShortUrl(urlData)
-	if err != nil {
-		h.log.Error(err)
-		fmt.Fprint(w, err)
-		return
+	if key := apiKeyFromContext(r.Context()); key != nil {
+		urlData.OwnerKeyId = key.Id
 	}
+	urlData.IdempotencyKey = r.Header.Get(idempotencyKeyHeader)
 
-	h.log.Debug(data)
-
-	bytes, err := json.Marshal(data)
+	data, err := h.repo.GenerateShortUrl(r.Context(), urlData)
 	if err != nil {
-		h.log.Error(err)
-		fmt.Fprint(w, err)
+		h.writeError(w, err)
 		return
 	}
-	answer := string(bytes)
 
-	h.log.Debug(answer)
-	fmt.Fprint(w, answer)
+	h.log.Debug(data)
+
+	h.writeJSON(w, http.StatusOK, data)
 }
 
 func (h *Handler) stat(w http.ResponseWriter, r *http.Request) {
 	h.log.Info("HandlerStats")
 
-	statId := strings.TrimLeft(r.RequestURI, "/stat/")
+	statId := mux.Vars(r)["statid"]
 
-	statsStruct, err := h.repo.GetStats(statId)
+	query := r.URL.Query()
+	filter, err := statsFilter(query)
 	if err != nil {
-		h.log.Error(err)
-		fmt.Fprint(w, err)
+		h.writeError(w, err)
 		return
 	}
 
-	h.log.Debug(statsStruct)
-
-	bytes, err := json.Marshal(statsStruct)
+	var statsStruct *models.StatsScheme
+	if query.Get("from") == "" && query.Get("to") == "" && query.Get("interval") == "" && query.Get("tz") == "" {
+		statsStruct, err = h.repo.GetStats(r.Context(), statId, filter)
+	} else {
+		var series models.SeriesQuery
+		series, err = seriesQuery(query)
+		if err == nil {
+			statsStruct, err = h.repo.GetStatsSeries(r.Context(), statId, filter, series)
+		}
+	}
 	if err != nil {
-		h.log.Error(err)
-		fmt.Fprint(w, err)
+		h.writeError(w, err)
 		return
 	}
-	answer := string(bytes)
 
-	h.log.Debug(answer)
-	fmt.Fprint(w, answer)
+	h.log.Debug(statsStruct)
+
+	h.writeJSON(w, http.StatusOK, statsStruct)
 }
 
 func (h *Handler) redirect(w http.ResponseWriter, r *http.Request) {
-	shortId := strings.TrimLeft(r.RequestURI, "/")
+	shortId := mux.Vars(r)["shorturl"]
 
-	urlScheme, err := h.repo.GetFullUrl(shortId)
+	urlScheme, err := h.repo.GetFullUrl(r.Context(), shortId)
 	if err != nil {
-		h.log.Error(err)
-		fmt.Fprint(w, err)
+		h.writeError(w, err)
 		return
 	}
 	url := urlScheme.Url
 
-	http.Redirect(w, r, url, http.StatusMovedPermanently)
-	go h.registerClick(shortId, r)
+	//permanent redirects are cached by browsers, so updated destination, expiration and clicks would be missed
+	http.Redirect(w, r, url, http.StatusFound)
+
+	h.clicks.Add(models.ClickEvent{
+		ShortId: shortId,
+		IP:      h.clientIP(r),
+		Time:    time.Now(),
+		ClickDetails: models.ClickDetails{
+			Referrer:  r.Referer(),
+			UserAgent: r.UserAgent(),
+			Language:  r.Header.Get("Accept-Language"),
+			Bot:       useragent.AutomatedRequest(r.Header),
+		},
+	})
 }
 
-func (h *Handler) registerClick(shortId string, r *http.Request) {
-
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		h.log.Errorf("can't split %s", r.RemoteAddr)
-		ip = "undefined"
-	} else {
-		netip := net.ParseIP(ip)
-		if netip == nil {
-			h.log.Errorf("can't get ip from %s", r.RemoteAddr)
-			ip = "undefined"
-		}
+//clientIP returns ip of request's client or "undefined"
+func (h *Handler) clientIP(r *http.Request) string {
+	ip := clientIPFromContext(r.Context())
+	if ip == nil {
+		h.log.Errorf("can't get ip from %s", r.RemoteAddr)
+		return "undefined"
 	}
 
-	err = h.repo.RegisterClick(shortId, ip)
-	if err != nil {
-		h.log.Errorf("can't register click %s from ip %s", shortId, ip)
-	}
+	return ip.String()
 }
 
 func LoggingMiddleware(logger *logrus.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
+			entry := logrus.NewEntry(logger)
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+				entry = entry.WithFields(logrus.Fields{"trace_id": sc.TraceID().String(), "span_id": sc.SpanID().String()})
+			}
 			defer func() {
 				if err := recover(); err != nil {
 					w.WriteHeader(http.StatusInternalServerError)
-					logger.Errorln(err)
+					entry.Errorln(err)
 				}
 			}()
 
-			logger.Infoln("method", r.Method, "path", r.URL.EscapedPath())
+			entry.Infoln("method", r.Method, "path", r.URL.EscapedPath())
 			next.ServeHTTP(w, r)
 
 		}
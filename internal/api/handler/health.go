@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+
+	"urlshortener/internal/health"
+)
+
+//healthz tells that process is alive, it doesn't depend on database so restarts don't cascade on its outage
+func (h *Handler) healthz(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, health.Report{Status: health.StatusOk, Components: map[string]health.ComponentStatus{}})
+}
+
+//readyz tells if instance can serve traffic, it fails when a component is down or instance is shutting down
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	if h.health == nil {
+		h.healthz(w, r)
+		return
+	}
+
+	report := h.health.Check(r.Context())
+	if !report.Ready() {
+		h.log.Warnf("instance is not ready: %+v", report.Components)
+		h.writeJSON(w, http.StatusServiceUnavailable, report)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/clickqueue"
+	usstorage "urlshortener/internal/db"
+	"urlshortener/internal/health"
+	"urlshortener/internal/repos/usrepo"
+)
+
+func TestHealthChecks(t *testing.T) {
+	log := logrus.New()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	var cacheErr error
+	checker := health.NewChecker(time.Second)
+	checker.Add("database", func(ctx context.Context) error { return nil })
+	checker.Add("cache", func(ctx context.Context) error { return cacheErr })
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{DefaultTTL: time.Hour})
+	clicks := clickqueue.NewQueue(log, uss, clickqueue.Config{Size: 10, BatchSize: 10, FlushInterval: time.Hour})
+	clicks.Start()
+	defer clicks.Stop()
+	router := NewHandler(log, us, clicks, Config{Health: checker})
+
+	get := func(path string) (int, health.Report) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var report health.Report
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, report
+	}
+
+	code, report := get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusOk, report.Status)
+	assert.Equal(t, health.StatusOk, report.Components["database"].Status)
+	assert.Equal(t, health.StatusOk, report.Components["cache"].Status)
+
+	cacheErr = errors.New("connection refused")
+	code, report = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusFail, report.Status)
+	assert.Equal(t, health.ComponentStatus{Status: health.StatusFail, Error: "connection refused"}, report.Components["cache"])
+
+	//liveness doesn't depend on components
+	code, report = get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusOk, report.Status)
+
+	cacheErr = nil
+	checker.ShutDown()
+	code, report = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusFail, report.Components["shutdown"].Status)
+
+	code, _ = get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"urlshortener/internal/models"
+	"urlshortener/internal/repos/usrepo"
+)
+
+//statIdHeader carries statId of a link as a credential to manage it
+const statIdHeader = "X-Stat-Id"
+
+func (h *Handler) getLink(w http.ResponseWriter, r *http.Request) {
+	link, err := h.repo.GetLink(r.Context(), mux.Vars(r)["id"], credentials(r))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, link)
+}
+
+func (h *Handler) updateLink(w http.ResponseWriter, r *http.Request) {
+	var update models.LinkUpdateScheme
+	err := json.NewDecoder(r.Body).Decode(&update)
+	if err != nil {
+		h.writeError(w, fmt.Errorf("%w: %v", models.ErrInvalidInput, err))
+		return
+	}
+
+	link, err := h.repo.UpdateLink(r.Context(), mux.Vars(r)["id"], update, credentials(r))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, link)
+}
+
+func (h *Handler) deleteLink(w http.ResponseWriter, r *http.Request) {
+	err := h.repo.DeleteLink(r.Context(), mux.Vars(r)["id"], credentials(r))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//listLinks returns links of api key making request
+func (h *Handler) listLinks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.LinkFilter{Host: query.Get("host")}
+
+	if key := apiKeyFromContext(r.Context()); key != nil {
+		filter.OwnerKeyId = key.Id
+	}
+
+	var err error
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil {
+			h.writeError(w, fmt.Errorf("%w: limit must be a number", models.ErrInvalidInput))
+			return
+		}
+	}
+
+	filter.CreatedFrom, err = parseDateParam(query.Get("createdFrom"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	filter.CreatedTo, err = parseDateParam(query.Get("createdTo"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	list, err := h.repo.ListLinks(r.Context(), filter, query.Get("cursor"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, list)
+}
+
+//credentials collects statId and api key of request which allow to manage a link
+func credentials(r *http.Request) usrepo.Credentials {
+	cred := usrepo.Credentials{StatId: r.Header.Get(statIdHeader)}
+	if key := apiKeyFromContext(r.Context()); key != nil {
+		cred.ApiKeyId = key.Id
+	}
+
+	return cred
+}
+
+//parseDateParam parses query parameter in RFC3339 or 2006-01-02 format, empty value gives zero time
+func parseDateParam(value string) (time.Time, error) {
+	return parseDateParamIn(value, time.Local)
+}
+
+//parseDateParamIn parses query parameter like parseDateParam, 2006-01-02 dates are taken in location
+func parseDateParamIn(value string, location *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	date, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return date, nil
+	}
+
+	date, err = time.ParseInLocation("2006-01-02", value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: date '%s' must be in RFC3339 or 2006-01-02 format", models.ErrInvalidInput, value)
+	}
+
+	return date, nil
+}
+
+//statsFilter parses excludeBots parameter of stats request
+func statsFilter(query url.Values) (models.StatsFilter, error) {
+	var filter models.StatsFilter
+	if value := query.Get("excludeBots"); value != "" {
+		excludeBots, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("%w: excludeBots must be true or false", models.ErrInvalidInput)
+		}
+		filter.ExcludeBots = excludeBots
+	}
+
+	return filter, nil
+}
+
+//seriesQuery parses from, to, interval and tz (IANA time zone) parameters of stats request
+func seriesQuery(query url.Values) (models.SeriesQuery, error) {
+	series := models.SeriesQuery{Interval: query.Get("interval"), Location: time.UTC}
+
+	if tz := query.Get("tz"); tz != "" {
+		location, err := time.LoadLocation(tz)
+		if err != nil {
+			return series, fmt.Errorf("%w: unknown time zone '%s'", models.ErrInvalidInput, tz)
+		}
+		series.Location = location
+	}
+
+	var err error
+	series.From, err = parseDateParamIn(query.Get("from"), series.Location)
+	if err != nil {
+		return series, err
+	}
+	series.To, err = parseDateParamIn(query.Get("to"), series.Location)
+	if err != nil {
+		return series, err
+	}
+
+	return series, nil
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/clickqueue"
+	usstorage "urlshortener/internal/db"
+	"urlshortener/internal/models"
+	"urlshortener/internal/repos/usrepo"
+)
+
+func TestLinksApi(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{AllowNeverExpires: true})
+	clicks := clickqueue.NewQueue(log, uss, clickqueue.Config{Size: 10, BatchSize: 10})
+	router := NewHandler(log, us, clicks, Config{AllowAnonymousCreate: true})
+
+	key, _ := us.CreateApiKey(ctx, "ci")
+	do := func(method string, path string, body string, header string, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	var owned, anonymous models.ShortLinkScheme
+	w := do("POST", "/generate", `{"Url": "http://yandex.ru", "NeverExpires": true}`, "Authorization", "Bearer "+key.Key)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &owned))
+	w = do("POST", "/generate", `{"Url": "http://ya.ru"}`, "", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &anonymous))
+
+	w = do("GET", "/api/v1/links/"+owned.ShortId, "", "Authorization", "Bearer "+key.Key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), owned.StatId)
+
+	w = do("GET", "/api/v1/links/"+anonymous.ShortId, "", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = do("GET", "/api/v1/links/"+anonymous.ShortId, "", "Authorization", "Bearer "+key.Key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do("PATCH", "/api/v1/links/"+anonymous.ShortId, `{"Url": "http://ya.ru/new"}`, statIdHeader, anonymous.StatId)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var link models.LinkScheme
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.Equal(t, "http://ya.ru/new", link.FullUrl)
+
+	w = do("PATCH", "/api/v1/links/"+anonymous.ShortId, `{"Url": "not a url"}`, statIdHeader, anonymous.StatId)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do("GET", "/api/v1/links", "", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = do("GET", "/api/v1/links?createdFrom=yesterday", "", "Authorization", "Bearer "+key.Key)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = do("GET", "/api/v1/links?host=yandex.ru&limit=10", "", "Authorization", "Bearer "+key.Key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list models.LinkListScheme
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Links, 1)
+	assert.Equal(t, owned.ShortId, list.Links[0].ShortId)
+
+	w = do("DELETE", "/api/v1/links/"+owned.ShortId, "", "Authorization", "Bearer "+key.Key)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = do("GET", "/"+owned.ShortId, "", "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGenerateIdempotencyKey(t *testing.T) {
+	log := logrus.New()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{})
+	clicks := clickqueue.NewQueue(log, uss, clickqueue.Config{Size: 10, BatchSize: 10})
+	router := NewHandler(log, us, clicks, Config{AllowAnonymousCreate: true})
+
+	key, _ := us.CreateApiKey(context.Background(), "ci")
+	generate := func(body string, apiKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/generate", strings.NewReader(body))
+		r.Header.Set(idempotencyKeyHeader, "retry-1")
+		if apiKey != "" {
+			r.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	var first, second models.ShortLinkScheme
+	w := generate(`{"Url": "http://yandex.ru"}`, key.Key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	w = generate(`{"Url": "http://yandex.ru"}`, key.Key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+	assert.Equal(t, first, second)
+
+	w = generate(`{"Url": "http://ya.ru"}`, key.Key)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	//anonymous callers don't share keys, otherwise replay would give away statId of another caller's link
+	var anonymous, other models.ShortLinkScheme
+	w = generate(`{"Url": "http://ya.ru"}`, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &anonymous))
+	w = generate(`{"Url": "http://ya.ru"}`, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &other))
+	assert.NotEqual(t, anonymous.ShortId, other.ShortId)
+	assert.NotEqual(t, anonymous.StatId, other.StatId)
+}
+
+func TestStatSeries(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{AllowNeverExpires: true})
+	clicks := clickqueue.NewQueue(log, uss, clickqueue.Config{Size: 10, BatchSize: 10})
+	router := NewHandler(log, us, clicks, Config{AllowAnonymousCreate: true})
+
+	link, _ := us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "http://yandex.ru", NeverExpires: true})
+	day := time.Date(2024, 1, 10, 21, 30, 0, 0, time.UTC)
+	assert.NoError(t, us.RegisterClicks(ctx, []models.ClickEvent{
+		{ShortId: link.ShortId, IP: "127.0.0.1", Time: day},
+		{ShortId: link.ShortId, IP: "127.0.0.1", Time: day.Add(time.Hour)},
+	}))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/stat/"+link.StatId+query, nil))
+		return w
+	}
+
+	w := get("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "Series")
+
+	w = get("?from=2024-01-10&to=2024-01-12&interval=day&tz=Europe/Moscow")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats models.StatsScheme
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, "Europe/Moscow", stats.Timezone)
+	assert.Equal(t, []*models.SeriesPointScheme{
+		{Start: "2024-01-10T00:00:00+03:00", Clicks: 0, Visitors: 0},
+		{Start: "2024-01-11T00:00:00+03:00", Clicks: 2, Visitors: 1},
+	}, stats.Series)
+
+	assert.Equal(t, http.StatusBadRequest, get("?tz=Mars/Olympus").Code)
+	assert.Equal(t, http.StatusBadRequest, get("?interval=year").Code)
+	assert.Equal(t, http.StatusBadRequest, get("?from=yesterday").Code)
+}
+
+func TestStatExcludeBots(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{AllowNeverExpires: true})
+	clicks := clickqueue.NewQueue(log, us, clickqueue.Config{Size: 10, BatchSize: 10, FlushInterval: time.Hour})
+	clicks.Start()
+	router := NewHandler(log, us, clicks, Config{AllowAnonymousCreate: true})
+
+	link, _ := us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "http://yandex.ru", NeverExpires: true})
+	redirect := func(userAgent string, purpose string) {
+		r := httptest.NewRequest("GET", "/"+link.ShortId, nil)
+		r.Header.Set("User-Agent", userAgent)
+		r.Header.Set("Accept", "text/html")
+		r.Header.Set("Sec-Purpose", purpose)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusFound, w.Code)
+	}
+	firefox := "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+	redirect(firefox, "")
+	redirect(firefox, "prefetch")
+	redirect("TelegramBot (like TwitterBot)", "")
+	clicks.Stop()
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/stat/"+link.StatId+query, nil))
+		return w
+	}
+
+	var stats models.StatsScheme
+	w := get("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, int64(3), stats.ClickCount)
+	assert.Equal(t, int64(1), stats.HumanClicks)
+	assert.Equal(t, int64(2), stats.BotClicks)
+	assert.Equal(t, int64(1), stats.UniqueVisitors)
+
+	w = get("?excludeBots=true&interval=day")
+	assert.Equal(t, http.StatusOK, w.Code)
+	stats = models.StatsScheme{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, int64(1), stats.ClickCount)
+	assert.Empty(t, stats.Clicks)
+	assert.Equal(t, int64(1), stats.Series[len(stats.Series)-1].Clicks)
+
+	w = get("?excludeBots=true")
+	assert.Equal(t, http.StatusOK, w.Code)
+	stats = models.StatsScheme{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Len(t, stats.Clicks, 1)
+	assert.Equal(t, "Firefox", stats.Clicks[0].Browser)
+
+	assert.Equal(t, http.StatusBadRequest, get("?excludeBots=maybe").Code)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+//MetricsMiddleware counts requests and measures their latency by route template, method and status code.
+//Requests which match no route aren't counted, so scanners can't blow up number of series
+func MetricsMiddleware(registerer prometheus.Registerer) func(http.Handler) http.Handler {
+	if registerer == nil {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	labels := []string{"route", "method", "code"}
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, labels)
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "urlshortener_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, labels)
+	registerer.MustRegister(requests, latency)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+
+			route := "unknown"
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+
+			code := strconv.Itoa(sw.status)
+			requests.WithLabelValues(route, r.Method, code).Inc()
+			latency.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+//statusWriter remembers status code of response
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+//Flush lets streamed responses reach client through the wrapper
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/clickqueue"
+	usstorage "urlshortener/internal/db"
+	"urlshortener/internal/models"
+	"urlshortener/internal/repos/usrepo"
+)
+
+func TestMetrics(t *testing.T) {
+	log := logrus.New()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{DefaultTTL: time.Hour})
+	clicks := clickqueue.NewQueue(log, uss, clickqueue.Config{Size: 10, BatchSize: 10, FlushInterval: time.Hour})
+	clicks.Start()
+	defer clicks.Stop()
+	registry := prometheus.NewRegistry()
+	router := NewHandler(log, us, clicks, Config{AllowAnonymousCreate: true, Metrics: registry, ServeMetrics: true})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/generate", strings.NewReader(`{"Url": "http://yandex.ru"}`)))
+	var link models.ShortLinkScheme
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/"+link.ShortId, nil))
+		assert.Equal(t, http.StatusFound, w.Code)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `urlshortener_http_requests_total{code="200",method="POST",route="/generate"} 1`)
+	assert.Contains(t, body, `urlshortener_http_requests_total{code="302",method="GET",route="/{shorturl}"} 2`)
+	assert.Contains(t, body, `urlshortener_http_requests_total{code="404",method="GET",route="/{shorturl}"} 1`)
+	assert.Contains(t, body, `urlshortener_http_request_duration_seconds_count{code="302",method="GET",route="/{shorturl}"} 2`)
+}
+
+func TestMetricsNotServedWithAdminPort(t *testing.T) {
+	log := logrus.New()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{DefaultTTL: time.Hour})
+	clicks := clickqueue.NewQueue(log, uss, clickqueue.Config{Size: 10, BatchSize: 10, FlushInterval: time.Hour})
+	clicks.Start()
+	defer clicks.Stop()
+	router := NewHandler(log, us, clicks, Config{Metrics: prometheus.NewRegistry()})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.NotEqual(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "urlshortener_http_requests_total")
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"urlshortener/internal/models"
+	"urlshortener/internal/ratelimit"
+)
+
+//RateLimitConfig holds limits of route classes kept in Store, nil Store turns limiting off.
+//Clients are told apart by ip found by RealIPMiddleware or, when KeyBy is "apikey", by api key with ip for anonymous ones.
+//Auth limits requests carrying api key per ip before the key is checked
+type RateLimitConfig struct {
+	Store    ratelimit.Store
+	Create   ratelimit.Limit
+	Redirect ratelimit.Limit
+	Stats    ratelimit.Limit
+	Auth     ratelimit.Limit
+	KeyBy    string
+}
+
+//Route classes having separate limits
+const (
+	rateClassCreate   = "create"
+	rateClassRedirect = "redirect"
+	rateClassStats    = "stats"
+	rateClassAuth     = "auth"
+)
+
+//RateLimitMiddleware limits requests of class per client with token bucket.
+//Responses get RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers,
+//requests over limit are rejected with 429 and Retry-After header.
+//Requests pass if store fails
+func RateLimitMiddleware(logger *logrus.Logger, cfg RateLimitConfig, class string, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	h := &Handler{log: logger}
+
+	return func(next http.Handler) http.Handler {
+		if cfg.Store == nil || !limit.Enabled() {
+			return next
+		}
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			result, err := cfg.Store.Take(class+":"+cfg.clientKey(r), limit, time.Now())
+			if err != nil {
+				logger.Error(err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(result.Reset))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+				h.writeError(w, models.ErrRateLimited)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+//AuthRateLimitMiddleware limits requests with Authorization header per ip before AuthMiddleware looks their keys up,
+//so clients sending invalid keys are throttled too. It must go after RealIPMiddleware and before AuthMiddleware
+func AuthRateLimitMiddleware(logger *logrus.Logger, cfg RateLimitConfig) func(http.Handler) http.Handler {
+	limitMiddleware := RateLimitMiddleware(logger, cfg, rateClassAuth, cfg.Auth)
+
+	return func(next http.Handler) http.Handler {
+		limited := limitMiddleware(next)
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limited.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+//clientKey returns key telling clients apart, it must go after RealIPMiddleware and AuthMiddleware
+func (cfg RateLimitConfig) clientKey(r *http.Request) string {
+	if cfg.KeyBy == "apikey" {
+		if key := apiKeyFromContext(r.Context()); key != nil {
+			return "key:" + strconv.FormatInt(key.Id, 10)
+		}
+	}
+
+	if ip := clientIPFromContext(r.Context()); ip != nil {
+		return "ip:" + ip.String()
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "ip:" + ip
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/clickqueue"
+	usstorage "urlshortener/internal/db"
+	"urlshortener/internal/models"
+	"urlshortener/internal/ratelimit"
+	"urlshortener/internal/realip"
+	"urlshortener/internal/repos/usrepo"
+)
+
+func TestRateLimit(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{DefaultTTL: time.Hour})
+	clicks := clickqueue.NewQueue(log, uss, clickqueue.Config{Size: 10, BatchSize: 10})
+	router := NewHandler(log, us, clicks, Config{
+		AllowAnonymousCreate: true,
+		RateLimit: RateLimitConfig{
+			Store:    ratelimit.NewMemory(),
+			Create:   ratelimit.Limit{Requests: 2, Period: time.Minute},
+			Redirect: ratelimit.Limit{Requests: 1, Period: time.Minute},
+			KeyBy:    "apikey",
+		},
+	})
+
+	key, _ := us.CreateApiKey(ctx, "ci")
+	do := func(method string, path string, body string, remoteAddr string, auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.RemoteAddr = remoteAddr
+		if auth != "" {
+			r.Header.Set("Authorization", "Bearer "+auth)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("POST", "/generate", `{"Url": "http://yandex.ru"}`, "10.0.0.1:1000", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+	var link models.ShortLinkScheme
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+
+	w = do("POST", "/generate", `{"Url": "http://yandex.ru"}`, "10.0.0.1:1001", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do("POST", "/generate", `{"Url": "http://yandex.ru"}`, "10.0.0.1:1002", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Contains(t, w.Body.String(), "rate_limited")
+
+	w = do("POST", "/generate", `{"Url": "http://yandex.ru"}`, "10.0.0.2:1000", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("POST", "/generate", `{"Url": "http://yandex.ru"}`, "10.0.0.1:1003", key.Key)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do("GET", "/"+link.ShortId, "", "10.0.0.1:1000", "")
+	assert.Equal(t, http.StatusFound, w.Code)
+	w = do("GET", "/"+link.ShortId, "", "10.0.0.1:1000", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	w = do("GET", "/stat/"+link.StatId, "", "10.0.0.1:1000", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get("RateLimit-Limit"))
+}
+
+func TestAuthRateLimit(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{DefaultTTL: time.Hour})
+	clicks := clickqueue.NewQueue(log, uss, clickqueue.Config{Size: 10, BatchSize: 10})
+	router := NewHandler(log, us, clicks, Config{
+		AllowAnonymousCreate: true,
+		RateLimit: RateLimitConfig{
+			Store: ratelimit.NewMemory(),
+			Auth:  ratelimit.Limit{Requests: 2, Period: time.Minute},
+			KeyBy: "apikey",
+		},
+	})
+
+	key, _ := us.CreateApiKey(ctx, "ci")
+	do := func(remoteAddr string, auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/generate", strings.NewReader(`{"Url": "http://yandex.ru"}`))
+		r.RemoteAddr = remoteAddr
+		if auth != "" {
+			r.Header.Set("Authorization", "Bearer "+auth)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	//invalid keys are limited before they are looked up
+	assert.Equal(t, http.StatusUnauthorized, do("10.0.0.1:1000", "invalid").Code)
+	assert.Equal(t, http.StatusUnauthorized, do("10.0.0.1:1000", "invalid").Code)
+	w := do("10.0.0.1:1000", "invalid")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusTooManyRequests, do("10.0.0.1:1000", key.Key).Code)
+
+	assert.Equal(t, http.StatusOK, do("10.0.0.1:1000", "").Code)
+	assert.Equal(t, http.StatusOK, do("10.0.0.2:1000", key.Key).Code)
+}
+
+func TestRateLimitClientKey(t *testing.T) {
+	resolver, err := realip.NewResolver([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	cfg := RateLimitConfig{}
+
+	var key string
+	router := RealIPMiddleware(logrus.New(), resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = cfg.clientKey(r)
+	}))
+	clientKey := func(remoteAddr string, forwardedFor string) string {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		return key
+	}
+
+	assert.Equal(t, "ip:10.0.0.1", clientKey("10.0.0.1:1000", ""))
+	assert.Equal(t, "ip:2.2.2.2", clientKey("10.0.0.1:1000", "1.1.1.1, 2.2.2.2"))
+	//untrusted peers can't pick their bucket with X-Forwarded-For
+	assert.Equal(t, "ip:3.3.3.3", clientKey("3.3.3.3:1000", "1.1.1.1, 2.2.2.2"))
+	assert.Equal(t, "ip:3.3.3.3", clientKey("3.3.3.3:1000", "garbage"))
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(key string, limit ratelimit.Limit, now time.Time) (ratelimit.Result, error) {
+	return ratelimit.Result{}, assert.AnError
+}
+
+func TestRateLimitStoreFailure(t *testing.T) {
+	log := logrus.New()
+	log.SetLevel(logrus.FatalLevel)
+	cfg := RateLimitConfig{Store: failingStore{}}
+	limit := ratelimit.Limit{Requests: 1, Period: time.Second}
+
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+	w := httptest.NewRecorder()
+	RateLimitMiddleware(log, cfg, rateClassStats, limit)(next).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"urlshortener/internal/realip"
+)
+
+//RealIPMiddleware puts client's ip into request context, nil resolver trusts no proxies
+func RealIPMiddleware(logger *logrus.Logger, resolver *realip.Resolver) func(http.Handler) http.Handler {
+	if resolver == nil {
+		resolver, _ = realip.NewResolver(nil)
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ip := resolver.ClientIP(r)
+			if ip != nil {
+				logger.Debugln("client", ip, "peer", r.RemoteAddr)
+				r = r.WithContext(context.WithValue(r.Context(), clientIPContextKey, ip))
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+//clientIPFromContext returns client's ip found by RealIPMiddleware, nil if it's unknown
+func clientIPFromContext(ctx context.Context) net.IP {
+	ip, _ := ctx.Value(clientIPContextKey).(net.IP)
+	return ip
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/clickqueue"
+	usstorage "urlshortener/internal/db"
+	"urlshortener/internal/models"
+	"urlshortener/internal/realip"
+	"urlshortener/internal/repos/usrepo"
+)
+
+func TestRedirectRegistersRealIP(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	resolver, err := realip.NewResolver([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{DefaultTTL: time.Hour})
+	clicks := clickqueue.NewQueue(log, uss, clickqueue.Config{Size: 10, BatchSize: 10, FlushInterval: time.Hour})
+	clicks.Start()
+	router := NewHandler(log, us, clicks, Config{AllowAnonymousCreate: true, RealIP: resolver})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/generate", strings.NewReader(`{"Url": "http://yandex.ru"}`)))
+	var link models.ShortLinkScheme
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+
+	redirect := func(remoteAddr string, forwardedFor string) {
+		r := httptest.NewRequest("GET", "/"+link.ShortId, nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		r.Header.Set("Referer", "https://t.co/x")
+		r.Header.Set("User-Agent", "curl/8.4.0")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusFound, w.Code)
+	}
+	redirect("10.0.0.1:1000", "203.0.113.7")
+	redirect("198.51.100.1:1000", "203.0.113.8")
+	clicks.Stop()
+
+	stats, err := us.GetStats(ctx, link.StatId, models.StatsFilter{})
+	assert.NoError(t, err)
+	var ips []string
+	for _, click := range stats.Clicks {
+		ips = append(ips, click.IP)
+	}
+	assert.Equal(t, "https://t.co/x", stats.Clicks[0].Referrer)
+	assert.Equal(t, "curl/8.4.0", stats.Clicks[0].UserAgent)
+	assert.ElementsMatch(t, []string{"203.0.113.7", "198.51.100.1"}, ips)
+}
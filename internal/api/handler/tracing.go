@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//tracerName is instrumentation name of spans started by http api
+const tracerName = "urlshortener/internal/api/handler"
+
+//TracingMiddleware starts server span of every request. Span continues trace which propagator finds in headers of the caller,
+//nil propagator is the global one. The span is passed to repository and storage through request context
+func TracingMiddleware(provider trace.TracerProvider, propagator propagation.TextMapPropagator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if provider == nil {
+			return next
+		}
+		tracer := provider.Tracer(tracerName)
+		if propagator == nil {
+			propagator = otel.GetTextMapPropagator()
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			//invalid traceparent is ignored and the request starts a new trace
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			route := "unknown"
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+
+			ctx, span := tracer.Start(ctx, r.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.EscapedPath()),
+			))
+			defer span.End()
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			span.SetAttributes(attribute.Int("http.response.status_code", sw.status))
+			if sw.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(sw.status))
+			}
+		})
+	}
+}
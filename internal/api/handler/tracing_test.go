@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"urlshortener/internal/clickqueue"
+	usstorage "urlshortener/internal/db"
+	"urlshortener/internal/models"
+	"urlshortener/internal/repos/usrepo"
+)
+
+func TestTracing(t *testing.T) {
+	log, hook := logtest.NewNullLogger()
+	uss, err := usstorage.NewUSStorage(log, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uss.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	us := usrepo.NewUrlShortener(uss, usrepo.Config{DefaultTTL: time.Hour})
+	clicks := clickqueue.NewQueue(log, uss, clickqueue.Config{Size: 10, BatchSize: 10, FlushInterval: time.Hour})
+	clicks.Start()
+	defer clicks.Stop()
+	router := NewHandler(log, us, clicks, Config{AllowAnonymousCreate: true, Tracer: provider, Propagator: propagation.TraceContext{}})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/generate", strings.NewReader(`{"Url": "http://yandex.ru"}`)))
+	var link models.ShortLinkScheme
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+
+	hook.Reset()
+	r := httptest.NewRequest("GET", "/"+link.ShortId, nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hook.Entries[0].Data["trace_id"])
+	assert.NotEmpty(t, hook.Entries[0].Data["span_id"])
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	generate := spans["POST /generate"]
+	assert.NotNil(t, generate)
+	assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", generate.SpanContext().TraceID().String())
+	assert.False(t, generate.Parent().IsValid())
+
+	redirect := spans["GET /{shorturl}"]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", redirect.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", redirect.Parent().SpanID().String())
+	assert.True(t, redirect.Parent().IsRemote())
+	assert.Equal(t, trace.SpanKindServer, redirect.SpanKind())
+	assert.Equal(t, hook.Entries[0].Data["span_id"], redirect.SpanContext().SpanID().String())
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("http.request.method", "GET"),
+		attribute.String("http.route", "/{shorturl}"),
+		attribute.String("url.path", "/"+link.ShortId),
+		attribute.Int("http.response.status_code", http.StatusFound),
+	}, redirect.Attributes())
+
+	getFullUrl := spans["UrlShortener.GetFullUrl"]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", getFullUrl.SpanContext().TraceID().String())
+	assert.Equal(t, redirect.SpanContext().SpanID(), getFullUrl.Parent().SpanID())
+}
+
+func TestTracingFollowsCallerSampling(t *testing.T) {
+	log, _ := logtest.NewNullLogger()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	handler := TracingMiddleware(provider, propagation.TraceContext{})(LoggingMiddleware(log)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Empty(t, recorder.Ended())
+
+	r.Header.Set("traceparent", "garbage")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Len(t, recorder.Ended(), 1)
+}
+
+func TestLoggingWithoutTracing(t *testing.T) {
+	log, hook := logtest.NewNullLogger()
+	log.Level = logrus.InfoLevel
+
+	handler := LoggingMiddleware(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Len(t, hook.Entries, 1)
+	assert.NotContains(t, hook.Entries[0].Data, "trace_id")
+}
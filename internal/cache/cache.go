@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"urlshortener/internal/models"
+	"urlshortener/internal/repos/usrepo"
+)
+
+//ErrMiss is returned by Cache.Get when key is absent or expired
+var ErrMiss = errors.New("cache miss")
+
+//Cache keeps string values for limited time
+type Cache interface {
+	Get(key string) (string, error)
+	Set(key string, value string, ttl time.Duration) error
+	Delete(key string) error
+	Close() error
+}
+
+const linkKeyPrefix = "link:"
+
+//generationShards is number of invalidation counters links are spread over
+const generationShards = 256
+
+//tracerName is instrumentation name of cache spans
+const tracerName = "urlshortener/internal/cache"
+
+//Repo is a read-through cache of full urls in front of UrlShortenerRepo.
+//Cached link lives no longer than ttl and its own expiration date
+type Repo struct {
+	//counters go first to be 64-bit aligned for atomic operations
+	hits   uint64
+	misses uint64
+	//generations are bumped on invalidation, so a lookup racing with it doesn't cache stale link
+	generations [generationShards]uint64
+
+	usrepo.UrlShortenerRepo
+	log   *logrus.Logger
+	cache Cache
+	ttl   time.Duration
+}
+
+func NewRepo(log *logrus.Logger, repo usrepo.UrlShortenerRepo, c Cache, ttl time.Duration) *Repo {
+	return &Repo{
+		UrlShortenerRepo: repo,
+		log:              log,
+		cache:            c,
+		ttl:              ttl,
+	}
+}
+
+//GetFullUrl returns cached full url or gets it from underlying repo and caches it.
+//Cache failures are logged and served by underlying repo
+func (r *Repo) GetFullUrl(ctx context.Context, shortId string) (urlScheme *models.FullUrlScheme, err error) {
+	ctx, span := startSpan(ctx, "cache.GetFullUrl")
+	defer func() { endSpan(span, err) }()
+
+	key := linkKeyPrefix + shortId
+
+	value, err := r.cache.Get(key)
+	if err == nil {
+		urlScheme = &models.FullUrlScheme{}
+		err = json.Unmarshal([]byte(value), urlScheme)
+		if err == nil {
+			atomic.AddUint64(&r.hits, 1)
+			span.SetAttributes(attribute.Bool("cache.hit", true))
+			r.log.Debug("cache hit ", shortId)
+			return urlScheme, nil
+		}
+	}
+	atomic.AddUint64(&r.misses, 1)
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+	if err != ErrMiss {
+		r.log.Errorf("can't get %s from cache, got %v", shortId, err)
+	}
+
+	generation := r.generation(shortId)
+	generationBefore := atomic.LoadUint64(generation)
+
+	urlScheme, err = r.UrlShortenerRepo.GetFullUrl(ctx, shortId)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := r.ttl
+	if !urlScheme.NeverExpires && urlScheme.ExpirationDate != "" {
+		expirationDate, err := time.Parse(time.RFC3339, urlScheme.ExpirationDate)
+		if err != nil {
+			r.log.Errorf("can't cache %s with expiration date %s", shortId, urlScheme.ExpirationDate)
+			return urlScheme, nil
+		}
+		if untilExpiration := time.Until(expirationDate); untilExpiration < ttl {
+			ttl = untilExpiration
+		}
+	}
+	if ttl <= 0 {
+		return urlScheme, nil
+	}
+
+	bytes, err := json.Marshal(urlScheme)
+	if err != nil {
+		r.log.Error(err)
+		return urlScheme, nil
+	}
+
+	if atomic.LoadUint64(generation) != generationBefore {
+		return urlScheme, nil
+	}
+	err = r.cache.Set(key, string(bytes), ttl)
+	if err != nil {
+		r.log.Errorf("can't put %s into cache, got %v", shortId, err)
+	}
+	//link may be invalidated between the check and Set, its delete could come before Set
+	if atomic.LoadUint64(generation) != generationBefore {
+		r.delete(shortId)
+	}
+
+	return urlScheme, nil
+}
+
+//generation returns invalidation counter of link, links may share counters
+func (r *Repo) generation(shortId string) *uint64 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(shortId))
+
+	return &r.generations[h.Sum32()%generationShards]
+}
+
+//Stats are numbers of redirects served from cache and from underlying repo since start
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+func (r *Repo) Stats() Stats {
+	return Stats{
+		Hits:   atomic.LoadUint64(&r.hits),
+		Misses: atomic.LoadUint64(&r.misses),
+	}
+}
+
+//UpdateLink updates link in underlying repo and removes its cached copy
+func (r *Repo) UpdateLink(ctx context.Context, shortId string, update models.LinkUpdateScheme) (link *models.LinkScheme, err error) {
+	link, err = r.UrlShortenerRepo.UpdateLink(ctx, shortId, update)
+	r.Invalidate(shortId)
+
+	return link, err
+}
+
+//DeleteLink deletes link in underlying repo and removes its cached copy
+func (r *Repo) DeleteLink(ctx context.Context, shortId string) (err error) {
+	err = r.UrlShortenerRepo.DeleteLink(ctx, shortId)
+	r.Invalidate(shortId)
+
+	return err
+}
+
+//Invalidate removes cached link, it must be called when link is changed or deleted
+func (r *Repo) Invalidate(shortId string) {
+	atomic.AddUint64(r.generation(shortId), 1)
+	r.delete(shortId)
+}
+
+func (r *Repo) delete(shortId string) {
+	err := r.cache.Delete(linkKeyPrefix + shortId)
+	if err != nil {
+		r.log.Errorf("can't delete %s from cache, got %v", shortId, err)
+	}
+}
+
+//startSpan starts child of the current span, the cache isn't traced outside of traced requests
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, name)
+}
+
+//endSpan ends span recording err if lookup failed
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
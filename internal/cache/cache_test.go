@@ -0,0 +1,370 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/models"
+	"urlshortener/internal/repos/usrepo"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Now()
+	c := NewLRU(2)
+	c.now = func() time.Time { return now }
+
+	assert.NoError(t, c.Set("a", "1", time.Minute))
+	assert.NoError(t, c.Set("b", "2", time.Minute))
+	v, err := c.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", v)
+
+	//b is least recently used
+	assert.NoError(t, c.Set("c", "3", time.Minute))
+	_, err = c.Get("b")
+	assert.Equal(t, ErrMiss, err)
+	assert.Equal(t, 2, c.Len())
+
+	now = now.Add(2 * time.Minute)
+	_, err = c.Get("a")
+	assert.Equal(t, ErrMiss, err)
+
+	assert.NoError(t, c.Set("c", "4", time.Minute))
+	assert.NoError(t, c.Delete("c"))
+	_, err = c.Get("c")
+	assert.Equal(t, ErrMiss, err)
+}
+
+//mockRepo embeds repo interface, methods not used by cache panic
+type mockRepo struct {
+	usrepo.UrlShortenerRepo
+	calls          int
+	expirationDate string
+	//onGetFullUrl is called after the link is read
+	onGetFullUrl func()
+}
+
+func (m *mockRepo) GenerateShortUrl(ctx context.Context, url models.FullUrlScheme) (data *models.ShortLinkScheme, err error) {
+	return &models.ShortLinkScheme{ShortId: "AQ"}, nil
+}
+
+func (m *mockRepo) GetFullUrl(ctx context.Context, shortId string) (urlScheme *models.FullUrlScheme, err error) {
+	m.calls++
+	if shortId != "AQ" {
+		return nil, models.ErrLinkNotFound
+	}
+	if m.onGetFullUrl != nil {
+		m.onGetFullUrl()
+	}
+	return &models.FullUrlScheme{Url: "http://yandex.ru", ExpirationDate: m.expirationDate}, nil
+}
+
+func (m *mockRepo) RegisterClicks(ctx context.Context, clicks []models.ClickEvent) (err error) {
+	return nil
+}
+
+func (m *mockRepo) GetStats(ctx context.Context, statId string, filter models.StatsFilter) (ss *models.StatsScheme, err error) {
+	return &models.StatsScheme{}, nil
+}
+
+func (m *mockRepo) UpdateLink(ctx context.Context, shortId string, update models.LinkUpdateScheme) (link *models.LinkScheme, err error) {
+	return &models.LinkScheme{ShortId: shortId}, nil
+}
+
+func (m *mockRepo) DeleteLink(ctx context.Context, shortId string) (err error) {
+	return nil
+}
+
+func TestRepo(t *testing.T) {
+	ctx := context.Background()
+	m := &mockRepo{expirationDate: time.Now().Add(time.Hour).Format(time.RFC3339)}
+	c := NewLRU(10)
+	r := NewRepo(logrus.New(), m, c, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		u, err := r.GetFullUrl(ctx, "AQ")
+		assert.NoError(t, err)
+		assert.Equal(t, "http://yandex.ru", u.Url)
+	}
+	assert.Equal(t, 1, m.calls)
+
+	r.Invalidate("AQ")
+	_, _ = r.GetFullUrl(ctx, "AQ")
+	assert.Equal(t, 2, m.calls)
+
+	_, err := r.UpdateLink(ctx, "AQ", models.LinkUpdateScheme{Url: "http://ya.ru"})
+	assert.NoError(t, err)
+	_, _ = r.GetFullUrl(ctx, "AQ")
+	assert.Equal(t, 3, m.calls)
+
+	assert.NoError(t, r.DeleteLink(ctx, "AQ"))
+	_, _ = r.GetFullUrl(ctx, "AQ")
+	assert.Equal(t, 4, m.calls)
+
+	_, err = r.GetFullUrl(ctx, "missing")
+	assert.ErrorIs(t, err, models.ErrLinkNotFound)
+	_, err = r.GetFullUrl(ctx, "missing")
+	assert.ErrorIs(t, err, models.ErrLinkNotFound)
+	assert.Equal(t, 6, m.calls)
+}
+
+func TestRepoDoesNotOutliveExpiration(t *testing.T) {
+	ctx := context.Background()
+	m := &mockRepo{expirationDate: time.Now().Add(time.Second).Format(time.RFC3339)}
+	c := NewLRU(10)
+	r := NewRepo(logrus.New(), m, c, time.Hour)
+
+	_, _ = r.GetFullUrl(ctx, "AQ")
+	c.now = func() time.Time { return time.Now().Add(2 * time.Second) }
+	_, _ = r.GetFullUrl(ctx, "AQ")
+
+	assert.Equal(t, 2, m.calls)
+}
+
+//hookCache calls onSet before putting value
+type hookCache struct {
+	Cache
+	onSet func()
+}
+
+func (c *hookCache) Set(key string, value string, ttl time.Duration) error {
+	if c.onSet != nil {
+		c.onSet()
+	}
+	return c.Cache.Set(key, value, ttl)
+}
+
+func TestRepoMissRacingInvalidate(t *testing.T) {
+	ctx := context.Background()
+	m := &mockRepo{expirationDate: time.Now().Add(time.Hour).Format(time.RFC3339)}
+	c := &hookCache{Cache: NewLRU(10)}
+	r := NewRepo(logrus.New(), m, c, time.Minute)
+	update := func() {
+		_, err := r.UpdateLink(ctx, "AQ", models.LinkUpdateScheme{Url: "http://ya.ru"})
+		assert.NoError(t, err)
+	}
+
+	//link is updated after it's read from repo
+	m.onGetFullUrl = update
+	_, err := r.GetFullUrl(ctx, "AQ")
+	assert.NoError(t, err)
+	m.onGetFullUrl = nil
+	_, err = c.Get(linkKeyPrefix + "AQ")
+	assert.Equal(t, ErrMiss, err)
+
+	//link is updated after generation is checked and before it's cached
+	c.onSet = func() {
+		c.onSet = nil
+		update()
+	}
+	_, err = r.GetFullUrl(ctx, "AQ")
+	assert.NoError(t, err)
+	_, err = c.Get(linkKeyPrefix + "AQ")
+	assert.Equal(t, ErrMiss, err)
+
+	//without invalidation link is cached
+	_, err = r.GetFullUrl(ctx, "AQ")
+	assert.NoError(t, err)
+	_, err = c.Get(linkKeyPrefix + "AQ")
+	assert.NoError(t, err)
+}
+
+func TestRedis(t *testing.T) {
+	s := startFakeRedis(t, "secret")
+	defer s.Close()
+
+	r, err := NewRedis("redis://:secret@"+s.Addr().String()+"/1", "us:", time.Second)
+	assert.NoError(t, err)
+	defer r.Close()
+
+	assert.NoError(t, r.Ping())
+
+	_, err = r.Get("a")
+	assert.Equal(t, ErrMiss, err)
+
+	assert.NoError(t, r.Set("a", "value with\r\nnewline", time.Minute))
+	v, err := r.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "value with\r\nnewline", v)
+
+	assert.NoError(t, r.Delete("a"))
+	_, err = r.Get("a")
+	assert.Equal(t, ErrMiss, err)
+
+	assert.NoError(t, r.Set("c", "3", time.Minute))
+	reply, err := r.Do("MGET", "us:c", "us:missing")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"3", nil}, reply)
+
+	//error inside array reply doesn't leave the rest of reply on pooled connection
+	reply, err = r.Do("EVAL", "return {redis.error_reply('boom'), 1}", "0")
+	assert.NoError(t, err)
+	items, _ := reply.([]interface{})
+	assert.Len(t, items, 2)
+	assert.EqualError(t, items[0].(error), "ERR boom")
+	assert.Equal(t, int64(1), items[1])
+	v, err = r.Get("c")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", v)
+
+	assert.NoError(t, r.Set("b", "1", time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, err = r.Get("b")
+	assert.Equal(t, ErrMiss, err)
+
+	bad, _ := NewRedis("redis://:wrong@"+s.Addr().String(), "us:", time.Second)
+	assert.Error(t, bad.Ping())
+}
+
+//fakeRedis is a minimal stand-in for redis server supporting AUTH, SELECT, PING, GET, MGET, SET with EX or PX and DEL.
+//EVAL replies with array holding an error whatever the script is
+type fakeRedis struct {
+	net.Listener
+	password string
+
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func startFakeRedis(t *testing.T, password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeRedis{
+		Listener: l,
+		password: password,
+		values:   make(map[string]string),
+		expires:  make(map[string]time.Time),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	authorized := s.password == ""
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(args[0])
+		if !authorized && command != "AUTH" {
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		io.WriteString(conn, s.execute(command, args[1:], &authorized))
+	}
+}
+
+func (s *fakeRedis) execute(command string, args []string, authorized *bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch command {
+	case "AUTH":
+		if args[0] != s.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		*authorized = true
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		value, ok := s.values[args[0]]
+		if !ok || !time.Now().Before(s.expires[args[0]]) {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "MGET":
+		reply := fmt.Sprintf("*%d\r\n", len(args))
+		for _, key := range args {
+			value, ok := s.values[key]
+			if !ok || !time.Now().Before(s.expires[key]) {
+				reply += "$-1\r\n"
+				continue
+			}
+			reply += fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+		}
+		return reply
+	case "SET":
+		ttl, _ := strconv.Atoi(args[3])
+		unit := time.Millisecond
+		if strings.ToUpper(args[2]) == "EX" {
+			unit = time.Second
+		}
+		s.values[args[0]] = args[1]
+		s.expires[args[0]] = time.Now().Add(time.Duration(ttl) * unit)
+		return "+OK\r\n"
+	case "DEL":
+		_, ok := s.values[args[0]]
+		delete(s.values, args[0])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "EVAL":
+		return "*2\r\n-ERR boom\r\n:1\r\n"
+	}
+
+	return "-ERR unknown command\r\n"
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		_, err = io.ReadFull(reader, buf)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+
+	return args, nil
+}
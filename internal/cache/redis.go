@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const redisPoolSize = 8
+
+//Redis is a cache stored in redis server
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+//NewRedis creates client for redis server at address given as host:port or
+//redis://[:password@]host:port[/db] url. All keys get prefix
+func NewRedis(address string, prefix string, timeout time.Duration) (*Redis, error) {
+	opt := &redis.Options{Addr: address}
+	if strings.Contains(address, "://") {
+		var err error
+		opt, err = redis.ParseURL(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis url: %w", err)
+		}
+	}
+	opt.PoolSize = redisPoolSize
+	opt.DialTimeout = timeout
+	opt.ReadTimeout = timeout
+	opt.WriteTimeout = timeout
+	opt.PoolTimeout = timeout
+
+	return &Redis{client: redis.NewClient(opt), prefix: prefix}, nil
+}
+
+func (r *Redis) Get(key string) (string, error) {
+	value, err := r.client.Get(context.Background(), r.prefix+key).Result()
+	if err == redis.Nil {
+		return "", ErrMiss
+	}
+
+	return value, err
+}
+
+func (r *Redis) Set(key string, value string, ttl time.Duration) error {
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+
+	return r.client.Set(context.Background(), r.prefix+key, value, ttl).Err()
+}
+
+func (r *Redis) Delete(key string) error {
+	return r.client.Del(context.Background(), r.prefix+key).Err()
+}
+
+//Ping checks connection to redis server
+func (r *Redis) Ping() error {
+	return r.client.Ping(context.Background()).Err()
+}
+
+//Close closes connections
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
+
+//Do sends command with keys taken as is, without prefix.
+//Replies are string, int64 or []interface{} of them, nil reply is returned as redis.Nil error
+//and error elements of arrays are redis.Error values
+func (r *Redis) Do(args ...string) (interface{}, error) {
+	cmdArgs := make([]interface{}, len(args))
+	for i, arg := range args {
+		cmdArgs[i] = arg
+	}
+
+	return r.client.Do(context.Background(), cmdArgs...).Result()
+}
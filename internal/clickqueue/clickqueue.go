@@ -0,0 +1,166 @@
+package clickqueue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"urlshortener/internal/models"
+)
+
+type Storage interface {
+	RegisterClicks(ctx context.Context, clicks []models.ClickEvent) error
+}
+
+//Config holds queue capacity and flush policy.
+//Batch is flushed when it reaches BatchSize clicks or FlushInterval passes
+type Config struct {
+	Size          int
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+//Stats are queue counters since start
+type Stats struct {
+	Enqueued uint64
+	Dropped  uint64
+	Flushed  uint64
+	Failed   uint64
+	Depth    int
+}
+
+//Queue collects clicks in bounded buffer and registers them in batches by single worker.
+//Clicks which don't fit into the buffer are dropped so redirects never wait for storage
+type Queue struct {
+	//counters go first to be 64-bit aligned for atomic operations
+	enqueued uint64
+	dropped  uint64
+	flushed  uint64
+	failed   uint64
+
+	log     *logrus.Logger
+	storage Storage
+	config  Config
+
+	clicks chan models.ClickEvent
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+func NewQueue(log *logrus.Logger, s Storage, cfg Config) *Queue {
+	return &Queue{
+		log:     log,
+		storage: s,
+		config:  cfg,
+		clicks:  make(chan models.ClickEvent, cfg.Size),
+		done:    make(chan struct{}),
+	}
+}
+
+//Start runs worker in background
+func (q *Queue) Start() {
+	go q.work()
+	q.log.Infof("Click queue started with size %d, batch size %d and flush interval %v",
+		q.config.Size, q.config.BatchSize, q.config.FlushInterval)
+}
+
+//Add puts click into the queue without blocking
+//returns false if click is dropped because queue is full or stopped
+func (q *Queue) Add(click models.ClickEvent) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if !q.closed {
+		select {
+		case q.clicks <- click:
+			atomic.AddUint64(&q.enqueued, 1)
+			return true
+		default:
+		}
+	}
+
+	if dropped := atomic.AddUint64(&q.dropped, 1); dropped == 1 || dropped%1000 == 0 {
+		q.log.Warnf("Click queue is full, %d clicks dropped so far", dropped)
+	}
+	return false
+}
+
+//Stop stops accepting clicks and waits until queued ones are registered
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.clicks)
+	}
+	q.mu.Unlock()
+
+	<-q.done
+	stats := q.Stats()
+	q.log.Infof("Click queue stopped, %d clicks registered, %d failed, %d dropped", stats.Flushed, stats.Failed, stats.Dropped)
+}
+
+func (q *Queue) Stats() Stats {
+	return Stats{
+		Enqueued: atomic.LoadUint64(&q.enqueued),
+		Dropped:  atomic.LoadUint64(&q.dropped),
+		Flushed:  atomic.LoadUint64(&q.flushed),
+		Failed:   atomic.LoadUint64(&q.failed),
+		Depth:    len(q.clicks),
+	}
+}
+
+func (q *Queue) work() {
+	defer close(q.done)
+
+	ticker := time.NewTicker(q.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.ClickEvent, 0, q.config.BatchSize)
+	for {
+		select {
+		case click, ok := <-q.clicks:
+			if !ok {
+				q.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= q.config.BatchSize {
+				q.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			q.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+//flush registers batch in one transaction, if it fails clicks are registered one by one
+//so a single bad click doesn't lose the whole batch
+func (q *Queue) flush(batch []models.ClickEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	err := q.storage.RegisterClicks(ctx, batch)
+	if err == nil {
+		atomic.AddUint64(&q.flushed, uint64(len(batch)))
+		return
+	}
+	q.log.Errorf("can't register batch of %d clicks, got %v", len(batch), err)
+
+	for _, click := range batch {
+		err = q.storage.RegisterClicks(ctx, []models.ClickEvent{click})
+		if err != nil {
+			q.log.Errorf("can't register click %s from ip %s", click.ShortId, click.IP)
+			atomic.AddUint64(&q.failed, 1)
+			continue
+		}
+		atomic.AddUint64(&q.flushed, 1)
+	}
+}
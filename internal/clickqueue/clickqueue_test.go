@@ -0,0 +1,114 @@
+package clickqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/models"
+)
+
+type mockStorage struct {
+	mu      sync.Mutex
+	batches [][]models.ClickEvent
+	block   chan struct{}
+}
+
+func (m *mockStorage) RegisterClicks(ctx context.Context, clicks []models.ClickEvent) error {
+	if m.block != nil {
+		<-m.block
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, click := range clicks {
+		if click.ShortId == "bad" {
+			return errors.New("bad click")
+		}
+	}
+	m.batches = append(m.batches, append([]models.ClickEvent(nil), clicks...))
+	return nil
+}
+
+func (m *mockStorage) count() (batches int, clicks int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, batch := range m.batches {
+		clicks += len(batch)
+	}
+	return len(m.batches), clicks
+}
+
+func TestBatching(t *testing.T) {
+	s := &mockStorage{}
+	q := NewQueue(logrus.New(), s, Config{Size: 100, BatchSize: 10, FlushInterval: time.Hour})
+	q.Start()
+
+	for i := 0; i < 25; i++ {
+		assert.True(t, q.Add(models.ClickEvent{ShortId: "AQ", IP: "127.0.0.1", Time: time.Now()}))
+	}
+	q.Stop()
+
+	batches, clicks := s.count()
+	assert.Equal(t, 3, batches)
+	assert.Equal(t, 25, clicks)
+	assert.Equal(t, uint64(25), q.Stats().Flushed)
+
+	assert.False(t, q.Add(models.ClickEvent{ShortId: "AQ"}))
+	assert.Equal(t, uint64(1), q.Stats().Dropped)
+}
+
+func TestFlushInterval(t *testing.T) {
+	s := &mockStorage{}
+	q := NewQueue(logrus.New(), s, Config{Size: 100, BatchSize: 10, FlushInterval: 10 * time.Millisecond})
+	q.Start()
+	defer q.Stop()
+
+	q.Add(models.ClickEvent{ShortId: "AQ"})
+	assert.Eventually(t, func() bool {
+		_, clicks := s.count()
+		return clicks == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestDropWhenFull(t *testing.T) {
+	s := &mockStorage{block: make(chan struct{})}
+	q := NewQueue(logrus.New(), s, Config{Size: 2, BatchSize: 1, FlushInterval: time.Hour})
+	q.Start()
+
+	//worker takes the first click and blocks in storage, two more fill the queue
+	q.Add(models.ClickEvent{ShortId: "AQ"})
+	assert.Eventually(t, func() bool { return q.Stats().Depth == 0 }, time.Second, time.Millisecond)
+	assert.True(t, q.Add(models.ClickEvent{ShortId: "AQ"}))
+	assert.True(t, q.Add(models.ClickEvent{ShortId: "AQ"}))
+	assert.False(t, q.Add(models.ClickEvent{ShortId: "AQ"}))
+
+	close(s.block)
+	q.Stop()
+
+	stats := q.Stats()
+	assert.Equal(t, uint64(3), stats.Flushed)
+	assert.Equal(t, uint64(1), stats.Dropped)
+}
+
+func TestFailedBatchIsRegisteredOneByOne(t *testing.T) {
+	s := &mockStorage{}
+	q := NewQueue(logrus.New(), s, Config{Size: 10, BatchSize: 3, FlushInterval: time.Hour})
+	q.Start()
+
+	q.Add(models.ClickEvent{ShortId: "AQ"})
+	q.Add(models.ClickEvent{ShortId: "bad"})
+	q.Add(models.ClickEvent{ShortId: "Ag"})
+	q.Stop()
+
+	_, clicks := s.count()
+	assert.Equal(t, 2, clicks)
+	assert.Equal(t, uint64(1), q.Stats().Failed)
+}
@@ -0,0 +1,109 @@
+package usstorage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"urlshortener/internal/models"
+)
+
+//CreateApiKey inserts new row into api_keys table
+func (d *dbdriver) CreateApiKey(ctx context.Context, name string, keyHash string) (key *models.ApiKeyScheme, err error) {
+	createdAt := time.Now().UTC()
+
+	insertSQL := `INSERT INTO api_keys(name, keyHash, createdAt) VALUES (?, ?, ?) RETURNING id`
+	var id int64
+	err = d.db.QueryRowContext(ctx, d.dialect.rebind(insertSQL), name, keyHash, createdAt).Scan(&id)
+	if err != nil {
+		d.log.Error(err)
+		return nil, err
+	}
+
+	key = &models.ApiKeyScheme{
+		Id:        id,
+		Name:      name,
+		CreatedAt: createdAt.Format("2006-01-02 15:04:05"),
+	}
+
+	return key, nil
+}
+
+//GetApiKey returns api key by its hash, revoked keys are returned too
+func (d *dbdriver) GetApiKey(ctx context.Context, keyHash string) (key *models.ApiKeyScheme, err error) {
+	query := `SELECT id, name, createdAt, revokedAt FROM api_keys WHERE keyHash = ?`
+	row := d.db.QueryRowContext(ctx, d.dialect.rebind(query), keyHash)
+
+	key, err = scanApiKey(row)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrApiKeyNotFound
+	} else if err != nil {
+		d.log.Error(err)
+		return nil, err
+	}
+
+	return key, nil
+}
+
+//ListApiKeys returns all api keys ordered by creation
+func (d *dbdriver) ListApiKeys(ctx context.Context) (keys []*models.ApiKeyScheme, err error) {
+	query := `SELECT id, name, createdAt, revokedAt FROM api_keys ORDER BY id`
+	rows, err := d.db.QueryContext(ctx, query)
+	if err != nil {
+		d.log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key, err := scanApiKey(rows)
+		if err != nil {
+			d.log.Error(err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+//RevokeApiKey sets revocation time of api key if it's not revoked yet
+func (d *dbdriver) RevokeApiKey(ctx context.Context, id int64) (err error) {
+	updateSQL := `UPDATE api_keys SET revokedAt = COALESCE(revokedAt, ?) WHERE id = ?`
+	sqlResult, err := d.db.ExecContext(ctx, d.dialect.rebind(updateSQL), time.Now().UTC(), id)
+	if err != nil {
+		d.log.Error(err)
+		return err
+	}
+
+	updated, err := sqlResult.RowsAffected()
+	if err != nil {
+		d.log.Error(err)
+		return err
+	}
+	if updated == 0 {
+		return models.ErrApiKeyNotFound
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanApiKey(row scanner) (*models.ApiKeyScheme, error) {
+	key := &models.ApiKeyScheme{}
+	var createdAt, revokedAt dbTime
+	err := row.Scan(&key.Id, &key.Name, &createdAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	key.CreatedAt = createdAt.Time.Format("2006-01-02 15:04:05")
+	if revokedAt.Valid {
+		key.RevokedAt = revokedAt.Time.Format("2006-01-02 15:04:05")
+	}
+
+	return key, nil
+}
@@ -0,0 +1,44 @@
+package usstorage
+
+import (
+	"fmt"
+	"time"
+)
+
+//sqlite3 driver returns TIME columns as strings in this format
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+//dbTime scans nullable time column regardless of how driver represents it
+type dbTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+//Scan implements sql.Scanner interface
+func (t *dbTime) Scan(value interface{}) error {
+	var err error
+	switch v := value.(type) {
+	case nil:
+		t.Time, t.Valid = time.Time{}, false
+		return nil
+	case time.Time:
+		t.Time = v
+	case string:
+		t.Time, err = parseDBTime(v)
+	case []byte:
+		t.Time, err = parseDBTime(string(v))
+	default:
+		err = fmt.Errorf("can't scan %T into time", value)
+	}
+
+	t.Valid = err == nil
+	return err
+}
+
+func parseDBTime(value string) (time.Time, error) {
+	result, err := time.Parse(sqliteTimeFormat, value)
+	if err != nil {
+		result, err = time.Parse(time.RFC3339Nano, value)
+	}
+	return result, err
+}
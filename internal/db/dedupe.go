@@ -0,0 +1,98 @@
+package usstorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"urlshortener/internal/models"
+)
+
+//idempotentResult returns link created before with the same owner's idempotency key, nil if there is no such link.
+//Key reused for another request is a conflict, key of deleted link is released
+func (d *dbdriver) idempotentResult(ctx context.Context, tx *sql.Tx, url models.FullUrlScheme) (*models.ShortLinkScheme, error) {
+	query := `SELECT idempotency_keys.requestHash, urls.shortId, urls.statId, urls.url, urls.expirationDate FROM idempotency_keys
+			LEFT JOIN urls
+				ON urls.id = idempotency_keys.urlId
+			WHERE idempotency_keys.ownerKeyId = ? AND idempotency_keys.idempotencyKey = ?`
+	row := tx.QueryRowContext(ctx, d.dialect.rebind(query), url.OwnerKeyId, url.IdempotencyKey)
+
+	var requestHash string
+	var shortId, statId, fullUrl sql.NullString
+	var expirationDate dbTime
+	err := row.Scan(&requestHash, &shortId, &statId, &fullUrl, &expirationDate)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if requestHash != url.RequestHash {
+		return nil, fmt.Errorf("%w: '%s'", models.ErrIdempotencyReused, url.IdempotencyKey)
+	}
+
+	if !shortId.Valid {
+		deleteSQL := `DELETE FROM idempotency_keys WHERE ownerKeyId = ? AND idempotencyKey = ?`
+		_, err = tx.ExecContext(ctx, d.dialect.rebind(deleteSQL), url.OwnerKeyId, url.IdempotencyKey)
+		return nil, err
+	}
+
+	return shortLink(shortId.String, statId.String, fullUrl.String, expirationDate), nil
+}
+
+//saveIdempotencyKey remembers link with urlId created for owner's idempotency key.
+//Key saved by concurrent request between lookup and insert aborts transaction, so it's reported as ErrIdempotencyBusy
+func (d *dbdriver) saveIdempotencyKey(ctx context.Context, tx *sql.Tx, url models.FullUrlScheme, urlId int64) error {
+	insertSQL := `INSERT INTO idempotency_keys(ownerKeyId, idempotencyKey, requestHash, urlId, createdAt) VALUES (?, ?, ?, ?, ?)`
+	_, err := tx.ExecContext(ctx, d.dialect.rebind(insertSQL), url.OwnerKeyId, url.IdempotencyKey, url.RequestHash, urlId, time.Now().UTC())
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: '%s'", models.ErrIdempotencyBusy, url.IdempotencyKey)
+	}
+
+	return err
+}
+
+//findActiveLink returns id and the newest active link of owner to normalized url, nil if there is no such link
+func (d *dbdriver) findActiveLink(ctx context.Context, tx *sql.Tx, normalizedUrl string, ownerKeyId int64) (int64, *models.ShortLinkScheme, error) {
+	query := `SELECT id, shortId, statId, url, expirationDate FROM urls
+			WHERE normalizedUrl = ? AND ownerKeyId = ? AND (expirationDate IS NULL OR expirationDate > ?)
+			ORDER BY id DESC LIMIT 1`
+	row := tx.QueryRowContext(ctx, d.dialect.rebind(query), normalizedUrl, ownerKeyId, time.Now().UTC())
+
+	var id int64
+	var shortId, statId, fullUrl string
+	var expirationDate dbTime
+	err := row.Scan(&id, &shortId, &statId, &fullUrl, &expirationDate)
+	if err == sql.ErrNoRows {
+		return 0, nil, nil
+	} else if err != nil {
+		return 0, nil, err
+	}
+
+	return id, shortLink(shortId, statId, fullUrl, expirationDate), nil
+}
+
+//DeleteIdempotencyKeysBefore deletes at most batchSize idempotency keys saved before given time
+//returns number of deleted rows
+func (d *dbdriver) DeleteIdempotencyKeysBefore(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	deleteSQL := fmt.Sprintf(`DELETE FROM idempotency_keys WHERE %[1]s IN (
+			SELECT %[1]s FROM idempotency_keys
+			WHERE createdAt < ?
+			LIMIT ?)`, d.dialect.rowId)
+
+	return d.deleteBatch(ctx, deleteSQL, before.UTC(), batchSize)
+}
+
+func shortLink(shortId string, statId string, fullUrl string, expirationDate dbTime) *models.ShortLinkScheme {
+	link := &models.ShortLinkScheme{
+		FullUrl: fullUrl,
+		ShortId: shortId,
+		StatId:  statId,
+	}
+	if expirationDate.Valid {
+		link.ExpirationDate = expirationDate.Time.Format("2006-01-02")
+	}
+
+	return link
+}
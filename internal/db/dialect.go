@@ -0,0 +1,79 @@
+package usstorage
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+//pqUniqueViolation is SQLSTATE of unique constraint violation
+const pqUniqueViolation = "23505"
+
+//dialect describes SQL differences between supported drivers.
+//Queries are written with '?' placeholders and rebound for drivers using numbered ones.
+//forUpdate locks selected rows till the end of transaction, sqlite locks the whole database on write anyway
+//tableExists query takes table name and returns if the table exists
+//lockMigrations begins transaction which holds the lock of migrations till its end
+type dialect struct {
+	name                 string
+	numberedPlaceholders bool
+	rowId                string
+	forUpdate            string
+	tableExists          string
+	lockMigrations       []string
+}
+
+var dialects = map[string]dialect{
+	"sqlite3": {
+		name:           "sqlite3",
+		rowId:          "rowid",
+		tableExists:    `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)`,
+		lockMigrations: []string{`BEGIN EXCLUSIVE`},
+	},
+	"postgres": {
+		name:                 "postgres",
+		numberedPlaceholders: true,
+		rowId:                "ctid",
+		forUpdate:            " FOR UPDATE",
+		tableExists:          `SELECT to_regclass(?) IS NOT NULL`,
+		lockMigrations:       []string{`BEGIN`, `SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))`},
+	},
+}
+
+//rebind replaces '?' placeholders with '$1', '$2'... for drivers which need it
+func (dl dialect) rebind(query string) string {
+	if !dl.numberedPlaceholders {
+		return query
+	}
+
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
+
+//isUniqueViolation checks if err is caused by duplicate value of unique column
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == pqUniqueViolation
+	}
+
+	return false
+}
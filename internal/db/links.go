@@ -0,0 +1,214 @@
+package usstorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"urlshortener/internal/models"
+)
+
+const linkColumns = `id, statId, shortId, url, expirationDate, createdAt, ownerKeyId`
+
+//GetLink returns link by its short id, expired links are returned too
+func (d *dbdriver) GetLink(ctx context.Context, shortId string) (link *models.LinkScheme, err error) {
+	query := `SELECT ` + linkColumns + ` FROM urls WHERE shortId = ?`
+	row := d.db.QueryRowContext(ctx, d.dialect.rebind(query), shortId)
+
+	link, err = scanLink(row)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrLinkNotFound
+	} else if err != nil {
+		d.log.Error(err)
+		return nil, err
+	}
+
+	return link, nil
+}
+
+//UpdateLink changes destination and expiration of link, update's expiration date must be in RFC3339 format
+func (d *dbdriver) UpdateLink(ctx context.Context, shortId string, update models.LinkUpdateScheme) (link *models.LinkScheme, err error) {
+	var sets []string
+	var args []interface{}
+
+	if update.Url != "" {
+		err = validateUrl(update.Url)
+		if err != nil {
+			return nil, err
+		}
+		normalizedUrl := update.NormalizedUrl
+		if normalizedUrl == "" {
+			normalizedUrl = update.Url
+		}
+		sets = append(sets, "url = ?", "normalizedUrl = ?", "host = ?")
+		args = append(args, update.Url, normalizedUrl, urlHost(update.Url))
+	}
+
+	if update.ExpirationDate != "" || update.NeverExpires {
+		expirationDate, err := getExpirationDate(models.FullUrlScheme{
+			ExpirationDate: update.ExpirationDate,
+			NeverExpires:   update.NeverExpires,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, "expirationDate = ?")
+		args = append(args, expirationDate)
+	}
+
+	if len(sets) > 0 {
+		updateSQL := `UPDATE urls SET ` + strings.Join(sets, ", ") + ` WHERE shortId = ?`
+		sqlResult, err := d.db.ExecContext(ctx, d.dialect.rebind(updateSQL), append(args, shortId)...)
+		if err != nil {
+			d.log.Error(err)
+			return nil, err
+		}
+
+		updated, err := sqlResult.RowsAffected()
+		if err != nil {
+			d.log.Error(err)
+			return nil, err
+		}
+		if updated == 0 {
+			return nil, models.ErrLinkNotFound
+		}
+	}
+
+	return d.GetLink(ctx, shortId)
+}
+
+//DeleteLink deletes link with its clicks and idempotency keys
+func (d *dbdriver) DeleteLink(ctx context.Context, shortId string) (err error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		d.log.Error(err)
+		return err
+	}
+
+	for _, deleteSQL := range []string{
+		`DELETE FROM clicks WHERE shortId = ?`,
+		`DELETE FROM click_rollups WHERE shortId = ?`,
+		`DELETE FROM idempotency_keys WHERE urlId IN (SELECT id FROM urls WHERE shortId = ?)`,
+	} {
+		_, err = tx.ExecContext(ctx, d.dialect.rebind(deleteSQL), shortId)
+		if err != nil {
+			d.log.Error(err)
+			d.rollback(tx)
+			return err
+		}
+	}
+
+	deleteSQL := `DELETE FROM urls WHERE shortId = ?`
+	sqlResult, err := tx.ExecContext(ctx, d.dialect.rebind(deleteSQL), shortId)
+	if err != nil {
+		d.log.Error(err)
+		d.rollback(tx)
+		return err
+	}
+
+	deleted, err := sqlResult.RowsAffected()
+	if err != nil {
+		d.log.Error(err)
+		d.rollback(tx)
+		return err
+	}
+	if deleted == 0 {
+		d.rollback(tx)
+		return models.ErrLinkNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		d.log.Error(err)
+		d.rollback(tx)
+	}
+
+	return err
+}
+
+//ListLinks returns at most filter.Limit links matching filter from the newest
+func (d *dbdriver) ListLinks(ctx context.Context, filter models.LinkFilter) (links []*models.LinkScheme, err error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.OwnerKeyId != 0 {
+		conditions = append(conditions, "ownerKeyId = ?")
+		args = append(args, filter.OwnerKeyId)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "createdAt >= ?")
+		args = append(args, filter.CreatedFrom.UTC())
+	}
+	if !filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "createdAt < ?")
+		args = append(args, filter.CreatedTo.UTC())
+	}
+	if filter.AfterId != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.AfterId)
+	}
+	if filter.Host != "" {
+		conditions = append(conditions, "host = ?")
+		args = append(args, strings.ToLower(filter.Host))
+	}
+
+	query := `SELECT ` + linkColumns + ` FROM urls`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d`, filter.Limit)
+	}
+
+	rows, err := d.db.QueryContext(ctx, d.dialect.rebind(query), args...)
+	if err != nil {
+		d.log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			d.log.Error(err)
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+func scanLink(row scanner) (*models.LinkScheme, error) {
+	link := &models.LinkScheme{}
+	var expirationDate, createdAt dbTime
+	var ownerKeyId sql.NullInt64
+	err := row.Scan(&link.Id, &link.StatId, &link.ShortId, &link.FullUrl, &expirationDate, &createdAt, &ownerKeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	if expirationDate.Valid {
+		link.ExpirationDate = expirationDate.Time.Format(time.RFC3339)
+	}
+	if createdAt.Valid {
+		link.CreatedAt = createdAt.Time.Format(time.RFC3339)
+	}
+	link.OwnerKeyId = ownerKeyId.Int64
+
+	return link, nil
+}
+
+//urlHost returns lowercased host of url links are filtered by, empty if url can't be parsed
+func urlHost(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
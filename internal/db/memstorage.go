@@ -0,0 +1,802 @@
+package usstorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"urlshortener/internal/hll"
+	"urlshortener/internal/models"
+)
+
+type memUrl struct {
+	id             int64
+	shortId        string
+	statId         string
+	url            string
+	expirationDate time.Time
+	neverExpires   bool
+	ownerKeyId     int64
+	createdAt      time.Time
+	normalizedUrl  string
+}
+
+//memIdempotencyKey refers link by id like urlId column does, so link of reused alias isn't replayed
+type memIdempotencyKey struct {
+	requestHash string
+	urlId       int64
+	shortId     string
+	createdAt   time.Time
+}
+
+//memRollup is hourly counter of clicks, bot clicks and human visitors
+type memRollup struct {
+	clicks    int64
+	botClicks int64
+	visitors  hll.Sketch
+}
+
+type memClick struct {
+	ip      string
+	time    time.Time
+	details models.ClickDetails
+}
+
+//memStorage keeps links in process memory, data is lost on restart.
+//It is meant for tests, ephemeral environments and benchmarks
+type memStorage struct {
+	log *logrus.Logger
+
+	mu      sync.RWMutex
+	lastId  int64
+	urls    map[string]*memUrl
+	statIds map[string]string
+	clicks  map[string][]memClick
+	rollups map[string]map[int64]*memRollup
+	salts   map[string]string
+
+	apiKeys   []*memApiKey
+	keyHashes map[string]*memApiKey
+
+	idempotencyKeys map[string]memIdempotencyKey
+}
+
+type memApiKey struct {
+	key     models.ApiKeyScheme
+	keyHash string
+}
+
+func newMemStorage(log *logrus.Logger, connectionString string, migrate bool) (Storage, error) {
+	return &memStorage{
+		log:     log,
+		urls:    make(map[string]*memUrl),
+		statIds: make(map[string]string),
+		clicks:  make(map[string][]memClick),
+		rollups: make(map[string]map[int64]*memRollup),
+		salts:   make(map[string]string),
+
+		keyHashes: make(map[string]*memApiKey),
+
+		idempotencyKeys: make(map[string]memIdempotencyKey),
+	}, nil
+}
+
+//Close does nothing, memory is released with storage itself
+func (m *memStorage) Close() {
+}
+
+//GenerateShortUrl stores new link
+//uses requested alias as shortId if it is set, otherwise derives shortId from link's sequence number
+func (m *memStorage) GenerateShortUrl(ctx context.Context, url models.FullUrlScheme) (data *models.ShortLinkScheme, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertUrl(url)
+}
+
+//GenerateShortUrls stores batch of links at once, invalid links and taken aliases fail their own rows only
+func (m *memStorage) GenerateShortUrls(ctx context.Context, urls []models.FullUrlScheme) (results []models.GenerateResult, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	results = make([]models.GenerateResult, len(urls))
+	for i, url := range urls {
+		data, err := m.insertUrl(url)
+		results[i] = models.GenerateResult{Data: data, Err: err}
+	}
+
+	return results, nil
+}
+
+//insertUrl stores new link, caller must hold the lock
+func (m *memStorage) insertUrl(url models.FullUrlScheme) (data *models.ShortLinkScheme, err error) {
+	err = validateUrl(url.Url)
+	if err != nil {
+		m.log.Error(err)
+		return nil, err
+	}
+
+	expirationDate, err := getExpirationDate(url)
+	if err != nil {
+		m.log.Error(err)
+		return nil, err
+	}
+
+	if url.NormalizedUrl == "" {
+		url.NormalizedUrl = url.Url
+	}
+
+	idempotencyKey := fmt.Sprintf("%d:%s", url.OwnerKeyId, url.IdempotencyKey)
+	if url.IdempotencyKey != "" {
+		saved, ok := m.idempotencyKeys[idempotencyKey]
+		if ok && saved.requestHash != url.RequestHash {
+			return nil, fmt.Errorf("%w: '%s'", models.ErrIdempotencyReused, url.IdempotencyKey)
+		}
+		if u, exists := m.urls[saved.shortId]; ok && exists && u.id == saved.urlId {
+			return u.shortLink(), nil
+		}
+	}
+
+	if url.Dedupe && url.Alias == "" && url.OwnerKeyId != 0 {
+		if u := m.findActiveLink(url.NormalizedUrl, url.OwnerKeyId); u != nil {
+			if url.IdempotencyKey != "" {
+				m.idempotencyKeys[idempotencyKey] = memIdempotencyKey{requestHash: url.RequestHash, urlId: u.id, shortId: u.shortId, createdAt: time.Now()}
+			}
+			return u.shortLink(), nil
+		}
+	}
+
+	shortId := url.Alias
+	if shortId != "" {
+		if _, taken := m.urls[shortId]; taken {
+			return nil, fmt.Errorf("%w: '%s'", models.ErrAliasTaken, shortId)
+		}
+	}
+
+	m.lastId++
+	if shortId == "" {
+		shortId = getShortId(m.lastId)
+		//generated id may be already taken by somebody's alias
+		if _, taken := m.urls[shortId]; taken {
+			shortId = NewStatKey()
+		}
+	}
+
+	u := &memUrl{
+		id:             m.lastId,
+		shortId:        shortId,
+		statId:         NewStatKey(),
+		url:            url.Url,
+		expirationDate: expirationDate.Time,
+		neverExpires:   !expirationDate.Valid,
+		ownerKeyId:     url.OwnerKeyId,
+		createdAt:      time.Now(),
+		normalizedUrl:  url.NormalizedUrl,
+	}
+	m.urls[u.shortId] = u
+	m.statIds[u.statId] = u.shortId
+
+	if url.IdempotencyKey != "" {
+		m.idempotencyKeys[idempotencyKey] = memIdempotencyKey{requestHash: url.RequestHash, urlId: u.id, shortId: u.shortId, createdAt: u.createdAt}
+	}
+
+	return u.shortLink(), nil
+}
+
+//findActiveLink returns the newest active link of owner to normalized url, caller must hold the lock
+func (m *memStorage) findActiveLink(normalizedUrl string, ownerKeyId int64) *memUrl {
+	var found *memUrl
+	now := time.Now()
+	for _, u := range m.urls {
+		if u.normalizedUrl != normalizedUrl || u.ownerKeyId != ownerKeyId || u.expired(now) {
+			continue
+		}
+		if found == nil || u.id > found.id {
+			found = u
+		}
+	}
+
+	return found
+}
+
+//DeleteIdempotencyKeysBefore deletes at most batchSize idempotency keys saved before given time
+//returns number of deleted keys
+func (m *memStorage) DeleteIdempotencyKeysBefore(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for key, saved := range m.idempotencyKeys {
+		if deleted >= int64(batchSize) {
+			break
+		}
+		if saved.createdAt.Before(before) {
+			delete(m.idempotencyKeys, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+//GetFullUrl converts short id into full url with its expiration
+//returns models.ErrLinkExpired if link's expiration date has passed
+func (m *memStorage) GetFullUrl(ctx context.Context, shortId string) (urlScheme *models.FullUrlScheme, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.urls[shortId]
+
+	if !ok {
+		m.log.Error(models.ErrLinkNotFound)
+		return nil, models.ErrLinkNotFound
+	}
+
+	if u.expired(time.Now()) {
+		return nil, fmt.Errorf("%w: '%s' expired at %s", models.ErrLinkExpired, shortId, u.expirationDate.Format("2006-01-02 15:04:05"))
+	}
+
+	urlScheme = &models.FullUrlScheme{Url: u.url, NeverExpires: u.neverExpires}
+	if !u.neverExpires {
+		urlScheme.ExpirationDate = u.expirationDate.Format(time.RFC3339)
+	}
+
+	return urlScheme, nil
+}
+
+//RegisterClicks stores batch of clicks, clicks of unknown links are skipped
+func (m *memStorage) RegisterClicks(ctx context.Context, clicks []models.ClickEvent) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, click := range clicks {
+		if _, ok := m.urls[click.ShortId]; !ok {
+			continue
+		}
+		m.addClick(click.ShortId, memClick{ip: click.IP, time: click.Time, details: click.ClickDetails}, click.VisitorHash)
+	}
+
+	return nil
+}
+
+//GetStats return stats scheme for short link using statId, clicks of bots are left out of it if filter excludes them
+func (m *memStorage) GetStats(ctx context.Context, statId string, filter models.StatsFilter) (ss *models.StatsScheme, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	shortId, ok := m.statIds[statId]
+	if !ok {
+		m.log.Error(models.ErrStatNotFound)
+		return nil, models.ErrStatNotFound
+	}
+	u := m.urls[shortId]
+	clicks := m.clicks[shortId]
+
+	var visitors hll.Sketch
+	for _, rollup := range m.rollups[shortId] {
+		visitors.Merge(&rollup.visitors)
+	}
+
+	var humans []memClick
+	for _, click := range clicks {
+		if !click.details.Bot {
+			humans = append(humans, click)
+		}
+	}
+
+	ss = &models.StatsScheme{
+		ClickCount:     int64(len(clicks)),
+		HumanClicks:    int64(len(humans)),
+		BotClicks:      int64(len(clicks) - len(humans)),
+		UniqueVisitors: visitors.Estimate(),
+	}
+	if filter.ExcludeBots {
+		clicks = humans
+		ss.ClickCount = ss.HumanClicks
+	}
+	if !u.neverExpires {
+		ss.ExpirationDate = u.expirationDate.Format("2006-01-02")
+	}
+
+	//clicks are appended in time order, the latest go first in stats
+	for i := len(clicks) - 1; i >= 0 && len(ss.Clicks) < 100; i-- {
+		ss.Clicks = append(ss.Clicks, &models.ClickScheme{
+			IP:           clicks[i].ip,
+			Time:         clicks[i].time.Format("2006-01-02 15:04:05"),
+			ClickDetails: clicks[i].details,
+		})
+	}
+
+	ss.Referrers = memBreakdown(clicks, func(d models.ClickDetails) string { return d.ReferrerHost })
+	ss.Browsers = memBreakdown(clicks, func(d models.ClickDetails) string { return d.Browser })
+	ss.OperatingSystems = memBreakdown(clicks, func(d models.ClickDetails) string { return d.OS })
+	ss.Devices = memBreakdown(clicks, func(d models.ClickDetails) string { return d.Device })
+	ss.Languages = memBreakdown(clicks, func(d models.ClickDetails) string { return d.Language })
+	ss.Countries = memBreakdown(clicks, func(d models.ClickDetails) string { return d.Country })
+
+	return ss, nil
+}
+
+//memBreakdown counts clicks by value, the most frequent values go first
+func memBreakdown(clicks []memClick, value func(models.ClickDetails) string) []*models.CountScheme {
+	counts := make(map[string]int64)
+	for _, click := range clicks {
+		counts[value(click.details)]++
+	}
+
+	var result []*models.CountScheme
+	for v, count := range counts {
+		result = append(result, &models.CountScheme{Value: v, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	if len(result) > breakdownSize {
+		result = result[:breakdownSize]
+	}
+
+	return result
+}
+
+//DeleteExpiredClicks deletes at most batchSize clicks of links expired before now
+//returns number of deleted clicks
+func (m *memStorage) DeleteExpiredClicks(ctx context.Context, now time.Time, batchSize int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for _, shortId := range m.sortedShortIds() {
+		if deleted >= int64(batchSize) {
+			break
+		}
+		if !m.urls[shortId].expired(now) {
+			continue
+		}
+
+		clicks := m.clicks[shortId]
+		n := len(clicks)
+		if int64(n) > int64(batchSize)-deleted {
+			n = batchSize - int(deleted)
+		}
+		m.clicks[shortId] = clicks[n:]
+		if len(m.clicks[shortId]) == 0 {
+			delete(m.clicks, shortId)
+		}
+		deleted += int64(n)
+	}
+
+	return deleted, nil
+}
+
+//DeleteExpiredRollups deletes at most batchSize hourly counters of links expired before now
+//returns number of deleted counters
+func (m *memStorage) DeleteExpiredRollups(ctx context.Context, now time.Time, batchSize int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for _, shortId := range m.sortedShortIds() {
+		if !m.urls[shortId].expired(now) {
+			continue
+		}
+
+		hours := m.rollups[shortId]
+		for hour := range hours {
+			if deleted >= int64(batchSize) {
+				return deleted, nil
+			}
+			delete(hours, hour)
+			deleted++
+		}
+		delete(m.rollups, shortId)
+	}
+
+	return deleted, nil
+}
+
+//GetClickRollups returns hourly clicks and bot clicks of link between from and to with sketches of their visitors
+func (m *memStorage) GetClickRollups(ctx context.Context, statId string, from time.Time, to time.Time) (rollups []*models.ClickRollup, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	shortId := m.statIds[statId]
+	for hour, r := range m.rollups[shortId] {
+		if hour < hourOf(from) || hour >= to.Unix() {
+			continue
+		}
+		visitors, err := r.visitors.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, &models.ClickRollup{
+			Hour:      time.Unix(hour, 0).UTC(),
+			Clicks:    r.clicks,
+			BotClicks: r.botClicks,
+			Visitors:  visitors,
+		})
+	}
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].Hour.Before(rollups[j].Hour) })
+
+	return rollups, nil
+}
+
+//GetStatsTotals returns click counts, unique visitors and expiration date of link counted from its hourly counters,
+//clicks of bots are left out of click count if filter excludes them
+func (m *memStorage) GetStatsTotals(ctx context.Context, statId string, filter models.StatsFilter) (ss *models.StatsScheme, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	shortId, ok := m.statIds[statId]
+	if !ok {
+		m.log.Error(models.ErrStatNotFound)
+		return nil, models.ErrStatNotFound
+	}
+	u := m.urls[shortId]
+
+	ss = &models.StatsScheme{}
+	var visitors hll.Sketch
+	for _, rollup := range m.rollups[shortId] {
+		ss.ClickCount += rollup.clicks
+		ss.BotClicks += rollup.botClicks
+		visitors.Merge(&rollup.visitors)
+	}
+	ss.HumanClicks = ss.ClickCount - ss.BotClicks
+	ss.UniqueVisitors = visitors.Estimate()
+	if filter.ExcludeBots {
+		ss.ClickCount = ss.HumanClicks
+	}
+	if !u.neverExpires {
+		ss.ExpirationDate = u.expirationDate.Format("2006-01-02")
+	}
+
+	return ss, nil
+}
+
+//VisitorSalt saves salt for day unless the day has one already and returns salt of the day
+func (m *memStorage) VisitorSalt(ctx context.Context, day string, salt string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if saved, ok := m.salts[day]; ok {
+		return saved, nil
+	}
+	m.salts[day] = salt
+
+	return salt, nil
+}
+
+//DeleteVisitorSaltsBefore deletes at most batchSize salts of days before given time
+//returns number of deleted salts
+func (m *memStorage) DeleteVisitorSaltsBefore(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	boundary := before.UTC().Format("2006-01-02")
+	var deleted int64
+	for day := range m.salts {
+		if deleted >= int64(batchSize) {
+			break
+		}
+		if day < boundary {
+			delete(m.salts, day)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+//DeleteExpiredUrls deletes at most batchSize links expired before now with their idempotency keys
+//returns number of deleted links
+func (m *memStorage) DeleteExpiredUrls(ctx context.Context, now time.Time, batchSize int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for _, shortId := range m.sortedShortIds() {
+		if deleted >= int64(batchSize) {
+			break
+		}
+		u := m.urls[shortId]
+		if !u.expired(now) {
+			continue
+		}
+
+		delete(m.urls, shortId)
+		delete(m.statIds, u.statId)
+		delete(m.clicks, shortId)
+		delete(m.rollups, shortId)
+		m.deleteIdempotencyKeys(u.id)
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+//DeleteClicksBefore deletes at most batchSize clicks registered before given time
+//returns number of deleted clicks
+func (m *memStorage) DeleteClicksBefore(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for _, shortId := range m.sortedShortIds() {
+		clicks := m.clicks[shortId]
+
+		//clicks are sorted by time so old ones are in the beginning
+		n := sort.Search(len(clicks), func(i int) bool { return !clicks[i].time.Before(before) })
+		if int64(n) > int64(batchSize)-deleted {
+			n = batchSize - int(deleted)
+		}
+		m.clicks[shortId] = clicks[n:]
+		if len(m.clicks[shortId]) == 0 {
+			delete(m.clicks, shortId)
+		}
+		deleted += int64(n)
+
+		if deleted >= int64(batchSize) {
+			break
+		}
+	}
+
+	return deleted, nil
+}
+
+//GetLink returns link by its short id, expired links are returned too
+func (m *memStorage) GetLink(ctx context.Context, shortId string) (link *models.LinkScheme, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.urls[shortId]
+	if !ok {
+		return nil, models.ErrLinkNotFound
+	}
+
+	return u.link(), nil
+}
+
+//UpdateLink changes destination and expiration of link, update's expiration date must be in RFC3339 format
+func (m *memStorage) UpdateLink(ctx context.Context, shortId string, update models.LinkUpdateScheme) (link *models.LinkScheme, err error) {
+	if update.Url != "" {
+		err = validateUrl(update.Url)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	changeExpiration := update.ExpirationDate != "" || update.NeverExpires
+	var expirationDate sql.NullTime
+	if changeExpiration {
+		expirationDate, err = getExpirationDate(models.FullUrlScheme{
+			ExpirationDate: update.ExpirationDate,
+			NeverExpires:   update.NeverExpires,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.urls[shortId]
+	if !ok {
+		return nil, models.ErrLinkNotFound
+	}
+
+	if update.Url != "" {
+		u.url = update.Url
+		u.normalizedUrl = update.NormalizedUrl
+		if u.normalizedUrl == "" {
+			u.normalizedUrl = update.Url
+		}
+	}
+	if changeExpiration {
+		u.expirationDate = expirationDate.Time
+		u.neverExpires = !expirationDate.Valid
+	}
+
+	return u.link(), nil
+}
+
+//DeleteLink deletes link with its clicks
+func (m *memStorage) DeleteLink(ctx context.Context, shortId string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.urls[shortId]
+	if !ok {
+		return models.ErrLinkNotFound
+	}
+
+	delete(m.urls, shortId)
+	delete(m.statIds, u.statId)
+	delete(m.clicks, shortId)
+	delete(m.rollups, shortId)
+	m.deleteIdempotencyKeys(u.id)
+
+	return nil
+}
+
+//deleteIdempotencyKeys deletes idempotency keys of link, caller must hold the lock
+func (m *memStorage) deleteIdempotencyKeys(urlId int64) {
+	for key, saved := range m.idempotencyKeys {
+		if saved.urlId == urlId {
+			delete(m.idempotencyKeys, key)
+		}
+	}
+}
+
+//ListLinks returns at most filter.Limit links matching filter from the newest
+func (m *memStorage) ListLinks(ctx context.Context, filter models.LinkFilter) (links []*models.LinkScheme, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	shortIds := m.sortedShortIds()
+	for i := len(shortIds) - 1; i >= 0 && (filter.Limit <= 0 || len(links) < filter.Limit); i-- {
+		u := m.urls[shortIds[i]]
+
+		switch {
+		case filter.OwnerKeyId != 0 && u.ownerKeyId != filter.OwnerKeyId,
+			!filter.CreatedFrom.IsZero() && u.createdAt.Before(filter.CreatedFrom),
+			!filter.CreatedTo.IsZero() && !u.createdAt.Before(filter.CreatedTo),
+			filter.AfterId != 0 && u.id >= filter.AfterId,
+			filter.Host != "" && urlHost(u.url) != strings.ToLower(filter.Host):
+			continue
+		}
+
+		links = append(links, u.link())
+	}
+
+	return links, nil
+}
+
+//CreateApiKey stores new api key
+func (m *memStorage) CreateApiKey(ctx context.Context, name string, keyHash string) (key *models.ApiKeyScheme, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.keyHashes[keyHash]; ok {
+		return nil, fmt.Errorf("%w: api key already exists", models.ErrConflict)
+	}
+
+	k := &memApiKey{
+		key: models.ApiKeyScheme{
+			Id:        int64(len(m.apiKeys) + 1),
+			Name:      name,
+			CreatedAt: time.Now().Format("2006-01-02 15:04:05"),
+		},
+		keyHash: keyHash,
+	}
+	m.apiKeys = append(m.apiKeys, k)
+	m.keyHashes[keyHash] = k
+
+	result := k.key
+	return &result, nil
+}
+
+//GetApiKey returns api key by its hash, revoked keys are returned too
+func (m *memStorage) GetApiKey(ctx context.Context, keyHash string) (key *models.ApiKeyScheme, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	k, ok := m.keyHashes[keyHash]
+	if !ok {
+		return nil, models.ErrApiKeyNotFound
+	}
+
+	result := k.key
+	return &result, nil
+}
+
+//ListApiKeys returns all api keys ordered by creation
+func (m *memStorage) ListApiKeys(ctx context.Context) (keys []*models.ApiKeyScheme, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, k := range m.apiKeys {
+		result := k.key
+		keys = append(keys, &result)
+	}
+
+	return keys, nil
+}
+
+//RevokeApiKey sets revocation time of api key if it's not revoked yet
+func (m *memStorage) RevokeApiKey(ctx context.Context, id int64) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > int64(len(m.apiKeys)) {
+		return models.ErrApiKeyNotFound
+	}
+
+	k := m.apiKeys[id-1]
+	if k.key.RevokedAt == "" {
+		k.key.RevokedAt = time.Now().Format("2006-01-02 15:04:05")
+	}
+
+	return nil
+}
+
+//addClick inserts click keeping link's clicks sorted by time and counts it with its human visitor in hourly counter,
+//caller must hold the lock
+func (m *memStorage) addClick(shortId string, click memClick, visitorHash uint64) {
+	clicks := m.clicks[shortId]
+	i := sort.Search(len(clicks), func(i int) bool { return clicks[i].time.After(click.time) })
+
+	clicks = append(clicks, memClick{})
+	copy(clicks[i+1:], clicks[i:])
+	clicks[i] = click
+	m.clicks[shortId] = clicks
+
+	hours, ok := m.rollups[shortId]
+	if !ok {
+		hours = make(map[int64]*memRollup)
+		m.rollups[shortId] = hours
+	}
+	rollup, ok := hours[hourOf(click.time)]
+	if !ok {
+		rollup = &memRollup{}
+		hours[hourOf(click.time)] = rollup
+	}
+	rollup.clicks++
+	if click.details.Bot {
+		rollup.botClicks++
+	} else if visitorHash != 0 {
+		rollup.visitors.Add(visitorHash)
+	}
+}
+
+//sortedShortIds returns short ids of links in creation order, caller must hold the lock
+func (m *memStorage) sortedShortIds() []string {
+	result := make([]string, 0, len(m.urls))
+	for shortId := range m.urls {
+		result = append(result, shortId)
+	}
+	sort.Slice(result, func(i, j int) bool { return m.urls[result[i]].id < m.urls[result[j]].id })
+
+	return result
+}
+
+func (u *memUrl) shortLink() *models.ShortLinkScheme {
+	result := &models.ShortLinkScheme{
+		FullUrl: u.url,
+		ShortId: u.shortId,
+		StatId:  u.statId,
+	}
+	if !u.neverExpires {
+		result.ExpirationDate = u.expirationDate.Format("2006-01-02")
+	}
+
+	return result
+}
+
+func (u *memUrl) link() *models.LinkScheme {
+	link := &models.LinkScheme{
+		Id:         u.id,
+		StatId:     u.statId,
+		ShortId:    u.shortId,
+		FullUrl:    u.url,
+		CreatedAt:  u.createdAt.Format(time.RFC3339),
+		OwnerKeyId: u.ownerKeyId,
+	}
+	if !u.neverExpires {
+		link.ExpirationDate = u.expirationDate.Format(time.RFC3339)
+	}
+
+	return link
+}
+
+func (u *memUrl) expired(now time.Time) bool {
+	return !u.neverExpires && !u.expirationDate.After(now)
+}
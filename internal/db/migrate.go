@@ -0,0 +1,249 @@
+package usstorage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//migrations/<dialect>/<version>_<name>.up.sql
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+//MigrationStatus describes a known migration and when it was applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+//loadMigrations reads migrations of dialect ordered by version
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := migrationsFS.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver '%s': %w", dialect, err)
+	}
+
+	var result []migration
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if !strings.HasSuffix(fileName, ".up.sql") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimSuffix(fileName, ".up.sql"), "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("migration file name '%s' must look like 0001_name.up.sql", fileName)
+		}
+
+		content, err := migrationsFS.ReadFile(path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, migration{version: version, name: parts[1], sql: string(content)})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].version < result[j].version })
+	for i := 1; i < len(result); i++ {
+		if result[i].version == result[i-1].version {
+			return nil, fmt.Errorf("duplicate migration version %d", result[i].version)
+		}
+	}
+
+	return result, nil
+}
+
+//execer is a database, connection or transaction statements run on
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+//createMigrationsTable creates schema_migrations table (if doesn't exists) with fields:
+//version INTEGER, name TEXT, appliedAt TIMESTAMP
+func (d *dbdriver) createMigrationsTable(ctx context.Context, e execer) error {
+	createSQL := `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version   INTEGER   PRIMARY KEY,
+			name      TEXT      NOT NULL,
+			appliedAt TIMESTAMP NOT NULL
+		);`
+
+	_, err := e.ExecContext(ctx, createSQL)
+	return err
+}
+
+//appliedMigrations returns applied migrations' application time by version,
+//database without schema_migrations table has none applied
+func (d *dbdriver) appliedMigrations(ctx context.Context, e execer) (map[int]time.Time, error) {
+	result := make(map[int]time.Time)
+
+	var exists bool
+	err := e.QueryRowContext(ctx, d.dialect.rebind(d.dialect.tableExists), "schema_migrations").Scan(&exists)
+	if err != nil || !exists {
+		return result, err
+	}
+
+	rows, err := e.QueryContext(ctx, `SELECT version, appliedAt FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var appliedAt dbTime
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		result[version] = appliedAt.Time
+	}
+
+	return result, rows.Err()
+}
+
+//MigrationsStatus lists known migrations with their application state
+//returns error if database has migrations this build doesn't know about
+func (d *dbdriver) MigrationsStatus() ([]MigrationStatus, error) {
+	return d.migrationsStatus(context.Background(), d.db)
+}
+
+func (d *dbdriver) migrationsStatus(ctx context.Context, e execer) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(d.dialect.name)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := d.appliedMigrations(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int]bool)
+	var result []MigrationStatus
+	for _, m := range migrations {
+		known[m.version] = true
+		appliedAt, ok := applied[m.version]
+		result = append(result, MigrationStatus{
+			Version:   m.version,
+			Name:      m.name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+
+	for version := range applied {
+		if !known[version] {
+			return result, fmt.Errorf("database schema version %d is newer than supported by this build, latest known is %d",
+				version, migrations[len(migrations)-1].version)
+		}
+	}
+
+	return result, nil
+}
+
+//Migrate applies pending migrations in order, each one in its own savepoint.
+//Migrations run in a transaction holding migrations lock and applied versions are read under it,
+//so instances started together wait for each other instead of applying the same migration twice.
+//Migrations applied before a failed one are kept
+//returns number of applied migrations
+func (d *dbdriver) Migrate() (count int, err error) {
+	ctx := context.Background()
+	migrations, err := loadMigrations(d.dialect.name)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	for _, lockSQL := range d.dialect.lockMigrations {
+		_, err = conn.ExecContext(ctx, lockSQL)
+		if err != nil {
+			conn.ExecContext(ctx, `ROLLBACK`)
+			return 0, fmt.Errorf("can't lock migrations: %w", err)
+		}
+	}
+	defer func() {
+		_, commitErr := conn.ExecContext(ctx, `COMMIT`)
+		if commitErr != nil {
+			conn.ExecContext(ctx, `ROLLBACK`)
+			if err == nil {
+				count, err = 0, commitErr
+			}
+		}
+	}()
+
+	err = d.createMigrationsTable(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	status, err := d.migrationsStatus(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := make(map[int]bool)
+	for _, s := range status {
+		applied[s.Version] = s.Applied
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		d.log.Infof("Applying migration %04d_%s", m.version, m.name)
+		err = d.applyMigration(ctx, conn, m)
+		if err != nil {
+			return count, fmt.Errorf("migration %04d_%s failed: %w", m.version, m.name, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+//applyMigration applies migration in a savepoint of transaction open on e and records it,
+//failed migration is rolled back to the savepoint
+func (d *dbdriver) applyMigration(ctx context.Context, e execer, m migration) error {
+	_, err := e.ExecContext(ctx, `SAVEPOINT migration`)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.ExecContext(ctx, m.sql)
+	if err == nil {
+		insertSQL := `INSERT INTO schema_migrations(version, name, appliedAt) VALUES (?, ?, ?)`
+		_, err = e.ExecContext(ctx, d.dialect.rebind(insertSQL), m.version, m.name, time.Now().UTC())
+	}
+	if err != nil {
+		e.ExecContext(ctx, `ROLLBACK TO SAVEPOINT migration`)
+		return err
+	}
+
+	_, err = e.ExecContext(ctx, `RELEASE SAVEPOINT migration`)
+	return err
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS urls (
+	id             BIGSERIAL   PRIMARY KEY,
+	shortId        TEXT        NOT NULL UNIQUE,
+	statId         TEXT        NOT NULL UNIQUE,
+	url            TEXT        NOT NULL,
+	expirationDate TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS clicks (
+	shortId TEXT        NOT NULL
+	                    REFERENCES urls (shortId) ON DELETE CASCADE,
+	IP      TEXT        NOT NULL,
+	time    TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id        BIGSERIAL   PRIMARY KEY,
+	name      TEXT        NOT NULL,
+	keyHash   TEXT        NOT NULL UNIQUE,
+	createdAt TIMESTAMPTZ NOT NULL,
+	revokedAt TIMESTAMPTZ
+);
+
+ALTER TABLE urls ADD COLUMN ownerKeyId BIGINT REFERENCES api_keys (id);
+
+CREATE INDEX IF NOT EXISTS urls_ownerKeyId ON urls (ownerKeyId);
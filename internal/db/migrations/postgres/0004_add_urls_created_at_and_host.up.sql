@@ -0,0 +1,18 @@
+ALTER TABLE urls ADD COLUMN createdAt TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS urls_createdAt ON urls (createdAt);
+
+ALTER TABLE urls ADD COLUMN host TEXT;
+
+-- host of existing links is cut out of url step by step: scheme, path with query and fragment, user info, port
+UPDATE urls SET host = substr(url, strpos(url, '://') + 3);
+UPDATE urls SET host = replace(replace(host, '?', '/'), '#', '/');
+UPDATE urls SET host = substr(host, 1, strpos(host || '/', '/') - 1);
+UPDATE urls SET host = substr(host, strpos(host, '@') + 1);
+UPDATE urls SET host = CASE
+	WHEN host LIKE '[%' THEN substr(host, 2, strpos(host, ']') - 2)
+	ELSE substr(host, 1, strpos(host || ':', ':') - 1)
+END;
+UPDATE urls SET host = lower(host);
+
+CREATE INDEX IF NOT EXISTS urls_host ON urls (host);
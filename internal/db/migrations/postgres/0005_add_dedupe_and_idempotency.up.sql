@@ -0,0 +1,15 @@
+ALTER TABLE urls ADD COLUMN normalizedUrl TEXT;
+
+CREATE INDEX IF NOT EXISTS urls_normalizedUrl_ownerKeyId ON urls (normalizedUrl, ownerKeyId);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	ownerKeyId     BIGINT      NOT NULL,
+	idempotencyKey TEXT        NOT NULL,
+	requestHash    TEXT        NOT NULL,
+	urlId          BIGINT      NOT NULL,
+	createdAt      TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (ownerKeyId, idempotencyKey)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_createdAt ON idempotency_keys (createdAt);
+CREATE INDEX IF NOT EXISTS idempotency_keys_urlId ON idempotency_keys (urlId);
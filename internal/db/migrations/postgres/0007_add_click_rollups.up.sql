@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS click_rollups (
+	shortId TEXT   NOT NULL,
+	hour    BIGINT NOT NULL,
+	clicks  BIGINT NOT NULL,
+	PRIMARY KEY (shortId, hour)
+);
+
+INSERT INTO click_rollups (shortId, hour, clicks)
+	SELECT shortId, FLOOR(EXTRACT(EPOCH FROM time) / 3600)::BIGINT * 3600, COUNT(*) FROM clicks
+	GROUP BY 1, 2;
@@ -0,0 +1,6 @@
+ALTER TABLE click_rollups ADD COLUMN visitors BYTEA;
+
+CREATE TABLE IF NOT EXISTS visitor_salts (
+	day  TEXT NOT NULL PRIMARY KEY,
+	salt TEXT NOT NULL
+);
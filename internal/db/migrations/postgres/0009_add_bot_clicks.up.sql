@@ -0,0 +1,9 @@
+ALTER TABLE click_rollups ADD COLUMN botClicks BIGINT NOT NULL DEFAULT 0;
+
+UPDATE click_rollups SET botClicks = bots.clicks
+	FROM (
+		SELECT shortId, FLOOR(EXTRACT(EPOCH FROM time) / 3600)::BIGINT * 3600 AS hour, COUNT(*) AS clicks FROM clicks
+		WHERE isBot
+		GROUP BY 1, 2
+	) AS bots
+	WHERE bots.shortId = click_rollups.shortId AND bots.hour = click_rollups.hour;
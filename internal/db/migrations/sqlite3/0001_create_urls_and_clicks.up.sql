@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS urls (
+	id		INTEGER PRIMARY KEY AUTOINCREMENT
+						UNIQUE
+						NOT NULL,
+	shortId	TEXT    NOT NULL
+						UNIQUE,
+	statId	TEXT    NOT NULL
+						UNIQUE,
+	url		TEXT    NOT NULL,
+	expirationDate TIME
+);
+
+CREATE TABLE IF NOT EXISTS clicks (
+	shortId TEXT NOT NULL
+				 REFERENCES urls (shortId) ON DELETE CASCADE,
+	IP      TEXT NOT NULL,
+	time    TIME NOT NULL
+);
+
+-- databases created before migrations keep times in local zone of the server, they are normalized to UTC
+UPDATE urls SET expirationDate = strftime('%Y-%m-%d %H:%M:%f+00:00', expirationDate) WHERE expirationDate IS NOT NULL;
+UPDATE clicks SET time = strftime('%Y-%m-%d %H:%M:%f+00:00', time);
@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS clicks_shortId_time ON clicks (shortId, time);
+
+CREATE INDEX IF NOT EXISTS clicks_time ON clicks (time);
+
+CREATE INDEX IF NOT EXISTS urls_expirationDate ON urls (expirationDate);
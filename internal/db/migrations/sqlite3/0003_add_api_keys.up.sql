@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT
+					  NOT NULL,
+	name      TEXT    NOT NULL,
+	keyHash   TEXT    NOT NULL
+					  UNIQUE,
+	createdAt TIME    NOT NULL,
+	revokedAt TIME
+);
+
+ALTER TABLE urls ADD COLUMN ownerKeyId INTEGER REFERENCES api_keys (id);
+
+CREATE INDEX IF NOT EXISTS urls_ownerKeyId ON urls (ownerKeyId);
@@ -0,0 +1,8 @@
+ALTER TABLE clicks ADD COLUMN referrer TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN referrerHost TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN userAgent TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN language TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN browser TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN os TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN device TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN isBot INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS click_rollups (
+	shortId TEXT    NOT NULL,
+	hour    INTEGER NOT NULL,
+	clicks  INTEGER NOT NULL,
+	PRIMARY KEY (shortId, hour)
+);
+
+INSERT INTO click_rollups (shortId, hour, clicks)
+	SELECT shortId, CAST(strftime('%s', time) AS INTEGER) / 3600 * 3600, COUNT(*) FROM clicks
+	GROUP BY 1, 2;
@@ -0,0 +1,7 @@
+ALTER TABLE click_rollups ADD COLUMN botClicks INTEGER NOT NULL DEFAULT 0;
+
+UPDATE click_rollups SET botClicks = (
+	SELECT COUNT(*) FROM clicks
+	WHERE clicks.shortId = click_rollups.shortId AND clicks.isBot
+		AND CAST(strftime('%s', clicks.time) AS INTEGER) / 3600 * 3600 = click_rollups.hour
+);
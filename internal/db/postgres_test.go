@@ -0,0 +1,95 @@
+package usstorage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+//postgresDSN is a connection string of postgres used by contract tests, empty if postgres is not available
+var postgresDSN string
+
+//TestMain takes postgres from USSTORAGE_TEST_POSTGRES connection string
+//or starts a temporary local one if initdb and pg_ctl binaries are found in PATH or PG_BIN directory
+func TestMain(m *testing.M) {
+	postgresDSN = os.Getenv("USSTORAGE_TEST_POSTGRES")
+
+	stop := func() {}
+	if postgresDSN == "" {
+		dsn, stopPostgres, err := startLocalPostgres()
+		if err != nil {
+			fmt.Println("postgres contract tests are skipped:", err)
+		} else {
+			postgresDSN, stop = dsn, stopPostgres
+		}
+	}
+
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+func startLocalPostgres() (string, func(), error) {
+	initdb, err := findPostgresBinary("initdb")
+	if err != nil {
+		return "", nil, err
+	}
+	pgctl, err := findPostgresBinary("pg_ctl")
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "usstorage-pg")
+	if err != nil {
+		return "", nil, err
+	}
+	dataDir := filepath.Join(dir, "data")
+
+	out, err := exec.Command(initdb, "-D", dataDir, "-U", "postgres", "-A", "trust", "--no-sync").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initdb failed: %v, %s", err, out)
+	}
+
+	//listen only on unix socket in temporary directory so there is no port conflicts
+	options := fmt.Sprintf("-c listen_addresses='' -k %s -p 5432 -c fsync=off", dir)
+	out, err = exec.Command(pgctl, "-D", dataDir, "-o", options, "-l", filepath.Join(dir, "log"), "-w", "start").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("pg_ctl start failed: %v, %s", err, out)
+	}
+
+	stop := func() {
+		exec.Command(pgctl, "-D", dataDir, "-m", "immediate", "-w", "stop").Run()
+		os.RemoveAll(dir)
+	}
+
+	dsn := fmt.Sprintf("host=%s port=5432 user=postgres dbname=postgres sslmode=disable", dir)
+	return dsn, stop, nil
+}
+
+func findPostgresBinary(name string) (string, error) {
+	if dir := os.Getenv("PG_BIN"); dir != "" {
+		return filepath.Join(dir, name), nil
+	}
+	return exec.LookPath(name)
+}
+
+func dropPostgresTables(t *testing.T, log *logrus.Logger) {
+	db, err := sql.Open("postgres", postgresDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DROP TABLE IF EXISTS clicks, click_rollups, visitor_salts, urls, api_keys, idempotency_keys, schema_migrations CASCADE`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Debug("postgres tables dropped")
+}
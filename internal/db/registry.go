@@ -0,0 +1,105 @@
+package usstorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"urlshortener/internal/repos/usrepo"
+)
+
+//Storage is a backend keeping short links and their clicks
+type Storage interface {
+	usrepo.UrlShortenerRepo
+
+	DeleteExpiredClicks(ctx context.Context, now time.Time, batchSize int) (int64, error)
+	DeleteExpiredRollups(ctx context.Context, now time.Time, batchSize int) (int64, error)
+	DeleteExpiredUrls(ctx context.Context, now time.Time, batchSize int) (int64, error)
+	DeleteClicksBefore(ctx context.Context, before time.Time, batchSize int) (int64, error)
+	DeleteIdempotencyKeysBefore(ctx context.Context, before time.Time, batchSize int) (int64, error)
+	DeleteVisitorSaltsBefore(ctx context.Context, before time.Time, batchSize int) (int64, error)
+
+	Close()
+}
+
+//Pool is implemented by storages keeping database connections in a pool
+type Pool interface {
+	PoolStats() sql.DBStats
+}
+
+//Pinger is implemented by storages connected to database server or file
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+//Migrator is implemented by storages with versioned schema
+type Migrator interface {
+	Migrate() (int, error)
+	MigrationsStatus() ([]MigrationStatus, error)
+}
+
+//Factory opens storage using connection string, migrate tells if storage may bring its schema up to date
+type Factory func(log *logrus.Logger, connectionString string, migrate bool) (Storage, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		"sqlite3":  newUSStorageSqlite3,
+		"postgres": newUSStoragePostgres,
+		"memory":   newMemStorage,
+	}
+)
+
+//Register makes storage backend available by name, registering the same name twice panics
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic("storage backend " + name + " is already registered")
+	}
+	registry[name] = factory
+}
+
+//Backends returns sorted names of registered storage backends
+func Backends() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+//NewUSStorage opens storage backend registered as dbdrivername and brings its schema up to date,
+//refuses to work with database schema newer than known migrations
+func NewUSStorage(log *logrus.Logger, dbdrivername string, dbname string) (Storage, error) {
+	return openStorage(log, dbdrivername, dbname, true)
+}
+
+//OpenUSStorage opens storage backend registered as dbdrivername without touching its schema
+func OpenUSStorage(log *logrus.Logger, dbdrivername string, dbname string) (Storage, error) {
+	return openStorage(log, dbdrivername, dbname, false)
+}
+
+func openStorage(log *logrus.Logger, dbdrivername string, dbname string, migrate bool) (Storage, error) {
+	registryMu.RLock()
+	factory, ok := registry[dbdrivername]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("storage backend '%s' is not registered, known backends are %v", dbdrivername, Backends())
+	}
+
+	log.Info("Opening storage ", dbdrivername)
+	return factory(log, dbname, migrate)
+}
@@ -0,0 +1,210 @@
+package usstorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"urlshortener/internal/hll"
+	"urlshortener/internal/models"
+)
+
+//rollupKey is an hour of link's clicks, hour is unix time of its start
+type rollupKey struct {
+	shortId string
+	hour    int64
+}
+
+func hourOf(t time.Time) int64 {
+	return t.Unix() - t.Unix()%3600
+}
+
+//rollup is a change of hourly counter
+type rollup struct {
+	clicks    int64
+	botClicks int64
+	visitors  hll.Sketch
+}
+
+//updateRollups adds clicks and their human visitors to hourly counters in transaction of their insertion.
+//Visitors' sketches are merged in code, so counters are locked while they're updated
+//and are updated in fixed order so concurrent batches don't deadlock
+func (d *dbdriver) updateRollups(ctx context.Context, tx *sql.Tx, clicks []models.ClickEvent) error {
+	changes := make(map[rollupKey]*rollup)
+	for _, click := range clicks {
+		key := rollupKey{shortId: click.ShortId, hour: hourOf(click.Time)}
+		change, ok := changes[key]
+		if !ok {
+			change = &rollup{}
+			changes[key] = change
+		}
+		change.clicks++
+		if click.Bot {
+			change.botClicks++
+		} else if click.VisitorHash != 0 {
+			change.visitors.Add(click.VisitorHash)
+		}
+	}
+
+	keys := make([]rollupKey, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].shortId != keys[j].shortId {
+			return keys[i].shortId < keys[j].shortId
+		}
+		return keys[i].hour < keys[j].hour
+	})
+
+	insertSQL := `INSERT INTO click_rollups(shortId, hour, clicks) VALUES (?, ?, 0) ON CONFLICT (shortId, hour) DO NOTHING`
+	selectSQL := `SELECT visitors FROM click_rollups WHERE shortId = ? AND hour = ?` + d.dialect.forUpdate
+	updateSQL := `UPDATE click_rollups SET clicks = clicks + ?, botClicks = botClicks + ?, visitors = ?
+		WHERE shortId = ? AND hour = ?`
+	for _, key := range keys {
+		_, err := tx.ExecContext(ctx, d.dialect.rebind(insertSQL), key.shortId, key.hour)
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+		err = tx.QueryRowContext(ctx, d.dialect.rebind(selectSQL), key.shortId, key.hour).Scan(&data)
+		if err != nil {
+			return err
+		}
+
+		var visitors hll.Sketch
+		err = visitors.UnmarshalBinary(data)
+		if err != nil {
+			return err
+		}
+		visitors.Merge(&changes[key].visitors)
+		data, err = visitors.MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, d.dialect.rebind(updateSQL), changes[key].clicks, changes[key].botClicks, data, key.shortId, key.hour)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//GetClickRollups returns hourly clicks and bot clicks of link between from and to with sketches of their visitors
+func (d *dbdriver) GetClickRollups(ctx context.Context, statId string, from time.Time, to time.Time) (rollups []*models.ClickRollup, err error) {
+	query := `SELECT click_rollups.hour, click_rollups.clicks, click_rollups.botClicks, click_rollups.visitors FROM click_rollups
+			INNER JOIN urls
+				ON urls.shortId = click_rollups.shortId
+			WHERE urls.statId = ? AND click_rollups.hour >= ? AND click_rollups.hour < ?
+			ORDER BY click_rollups.hour`
+	rows, err := d.db.QueryContext(ctx, d.dialect.rebind(query), statId, hourOf(from), to.Unix())
+	if err != nil {
+		d.log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hour int64
+		rollup := &models.ClickRollup{}
+		err = rows.Scan(&hour, &rollup.Clicks, &rollup.BotClicks, &rollup.Visitors)
+		if err != nil {
+			d.log.Error(err)
+			return nil, err
+		}
+		rollup.Hour = time.Unix(hour, 0).UTC()
+		rollups = append(rollups, rollup)
+	}
+
+	return rollups, rows.Err()
+}
+
+//GetStatsTotals returns click counts, unique visitors and expiration date of link counted from its hourly counters,
+//clicks of bots are left out of click count if filter excludes them
+func (d *dbdriver) GetStatsTotals(ctx context.Context, statId string, filter models.StatsFilter) (ss *models.StatsScheme, err error) {
+	query := `SELECT urls.shortId, MAX(urls.expirationDate) as expirationDate, COALESCE(SUM(click_rollups.clicks),0) as clickCount,
+				COALESCE(SUM(click_rollups.botClicks),0) as botCount FROM urls
+			LEFT JOIN click_rollups
+				ON urls.shortId = click_rollups.shortId
+			WHERE urls.statId = ?
+			GROUP BY urls.shortId`
+	row := d.db.QueryRowContext(ctx, d.dialect.rebind(query), statId)
+
+	var shortId string
+	var expirationDate dbTime
+	var clicksCount, botCount int64
+	err = row.Scan(&shortId, &expirationDate, &clicksCount, &botCount)
+	if err == sql.ErrNoRows {
+		d.log.Error(models.ErrStatNotFound)
+		return nil, models.ErrStatNotFound
+	} else if err != nil {
+		d.log.Error(err)
+		return nil, err
+	}
+
+	uniqueVisitors, err := d.uniqueVisitors(ctx, shortId)
+	if err != nil {
+		d.log.Error(err)
+		return nil, err
+	}
+
+	ss = &models.StatsScheme{
+		ClickCount:     clicksCount,
+		HumanClicks:    clicksCount - botCount,
+		BotClicks:      botCount,
+		UniqueVisitors: uniqueVisitors,
+	}
+	if filter.ExcludeBots {
+		ss.ClickCount = ss.HumanClicks
+	}
+	if expirationDate.Valid {
+		ss.ExpirationDate = expirationDate.Time.Format("2006-01-02")
+	}
+
+	return ss, nil
+}
+
+//uniqueVisitors estimates number of unique visitors of link from sketches of all its hours
+func (d *dbdriver) uniqueVisitors(ctx context.Context, shortId string) (int64, error) {
+	query := `SELECT visitors FROM click_rollups WHERE shortId = ? AND visitors IS NOT NULL`
+	rows, err := d.db.QueryContext(ctx, d.dialect.rebind(query), shortId)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var visitors hll.Sketch
+	for rows.Next() {
+		var data []byte
+		var hour hll.Sketch
+		err = rows.Scan(&data)
+		if err != nil {
+			return 0, err
+		}
+		err = hour.UnmarshalBinary(data)
+		if err != nil {
+			return 0, err
+		}
+		visitors.Merge(&hour)
+	}
+
+	return visitors.Estimate(), rows.Err()
+}
+
+//DeleteExpiredRollups deletes at most batchSize hourly counters of links expired before now
+//returns number of deleted rows
+func (d *dbdriver) DeleteExpiredRollups(ctx context.Context, now time.Time, batchSize int) (int64, error) {
+	deleteSQL := fmt.Sprintf(`DELETE FROM click_rollups WHERE %[1]s IN (
+			SELECT click_rollups.%[1]s FROM click_rollups
+				INNER JOIN urls
+					ON urls.shortId = click_rollups.shortId
+			WHERE urls.expirationDate < ?
+			LIMIT ?)`, d.dialect.rowId)
+
+	return d.deleteBatch(ctx, deleteSQL, now.UTC(), batchSize)
+}
@@ -0,0 +1,37 @@
+package usstorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+//VisitorSalt saves salt for day unless the day has one already and returns salt of the day
+func (d *dbdriver) VisitorSalt(ctx context.Context, day string, salt string) (string, error) {
+	insertSQL := `INSERT INTO visitor_salts(day, salt) VALUES (?, ?) ON CONFLICT (day) DO NOTHING`
+	_, err := d.db.ExecContext(ctx, d.dialect.rebind(insertSQL), day, salt)
+	if err != nil {
+		d.log.Error(err)
+		return "", err
+	}
+
+	err = d.db.QueryRowContext(ctx, d.dialect.rebind(`SELECT salt FROM visitor_salts WHERE day = ?`), day).Scan(&salt)
+	if err != nil {
+		d.log.Error(err)
+		return "", err
+	}
+
+	return salt, nil
+}
+
+//DeleteVisitorSaltsBefore deletes at most batchSize salts of days before given time,
+//visitor hashes made with them can't be linked to ips anymore
+//returns number of deleted rows
+func (d *dbdriver) DeleteVisitorSaltsBefore(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	deleteSQL := fmt.Sprintf(`DELETE FROM visitor_salts WHERE %[1]s IN (
+			SELECT %[1]s FROM visitor_salts
+			WHERE day < ?
+			LIMIT ?)`, d.dialect.rowId)
+
+	return d.deleteBatch(ctx, deleteSQL, before.UTC().Format("2006-01-02"), batchSize)
+}
@@ -3,89 +3,110 @@ package usstorage
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"os"
 	"time"
 
-	_ "github.com/lib/pq"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/XSAM/otelsql"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 )
 
 type dbdriver struct {
-	db  *sql.DB
-	log *logrus.Logger
+	db      *sql.DB
+	log     *logrus.Logger
+	dialect dialect
+	//file is a path of sqlite database, empty for database servers
+	file string
 }
 
-func NewUSStorage(log *logrus.Logger, dbdrivername string, dbname string) *dbdriver {
-	log.Info(dbdrivername, " ", dbname)
-	if dbdrivername == "sqlite3" {
-		return newUSStorageSqlite3(log, dbdrivername, dbname)
-	}
-	if dbdrivername == "postgres" {
-		return newUSStoragePostgres(log, dbdrivername, dbname)
-	}
-	log.Fatalf("Work with driver '%s' not defined", dbdrivername)
-	return nil
-}
-
-func newUSStorageSqlite3(log *logrus.Logger, dbdrivername string, dbname string) *dbdriver {
+func newUSStorageSqlite3(log *logrus.Logger, dbname string, migrate bool) (Storage, error) {
 
 	dir := "./database"
 	filename := "./database/" + dbname
 	err := os.MkdirAll(dir, 0755)
 	if err != nil {
-		log.Fatal("can't create database directory", err)
+		return nil, fmt.Errorf("can't create database directory: %w", err)
 	}
 
 	if _, err = os.Stat(filename); errors.Is(err, os.ErrNotExist) {
-		_, err = os.Create(filename)
+		f, err := os.Create(filename)
 		if err != nil {
-			log.Fatal("can't create database file", err)
+			return nil, fmt.Errorf("can't create database file: %w", err)
 		}
+		f.Close()
 	} else if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	db, err := sql.Open(dbdrivername, filename)
+	db, err := openTraced("sqlite3", filename, semconv.DBSystemSqlite)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
-	db.SetConnMaxLifetime(5 * time.Minute)
-
-	CreateUrlsTableSqlite3(db, log)
-	CreateClicksTableSqlite3(db, log)
-
-	return &dbdriver{
-		db:  db,
-		log: log,
+	d, err := newDBDriver(log, db, dialects["sqlite3"], migrate)
+	if err != nil {
+		return nil, err
 	}
+	d.file = filename
+
+	return d, nil
 }
 
-func newUSStoragePostgres(log *logrus.Logger, dbdrivername string, dbname string) *dbdriver {
+func newUSStoragePostgres(log *logrus.Logger, dbname string, migrate bool) (Storage, error) {
 
-	db, err := sql.Open(dbdrivername, dbname)
+	db, err := openTraced("postgres", dbname, semconv.DBSystemPostgreSQL)
 	if err != nil {
-		log.Fatal("Cant connect to database", err)
+		return nil, fmt.Errorf("can't connect to database: %w", err)
 	}
 
 	err = db.Ping()
 	if err != nil {
-		log.Fatal(err)
+		db.Close()
+		return nil, err
 	}
 	log.Info("ping")
 
+	d, err := newDBDriver(log, db, dialects["postgres"], migrate)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+//openTraced opens database whose queries are client spans of the current span
+func openTraced(driverName string, dsn string, system attribute.KeyValue) (*sql.DB, error) {
+	return otelsql.Open(driverName, dsn,
+		otelsql.WithAttributes(system),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			OmitConnectorConnect: true,
+		}))
+}
+
+func newDBDriver(log *logrus.Logger, db *sql.DB, dl dialect, migrate bool) (*dbdriver, error) {
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(25)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
-	CreateUrlsTablePostgres(db, log)
-	CreateClicksTablePostgres(db, log)
+	d := &dbdriver{
+		db:      db,
+		log:     log,
+		dialect: dl,
+	}
 
-	return &dbdriver{
-		db:  db,
-		log: log,
+	if migrate {
+		applied, err := d.Migrate()
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("can't migrate database: %w", err)
+		}
+		log.Infof("%d migrations applied", applied)
 	}
+
+	return d, nil
 }
@@ -1,10 +1,12 @@
 package usstorage
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"math/big"
-	neturl "net/url"
+	"os"
 	"strings"
 	"time"
 
@@ -13,353 +15,473 @@ import (
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/sirupsen/logrus"
 
 	"urlshortener/internal/models"
+	"urlshortener/internal/urlnorm"
 )
 
-//CreateUrlsTable creates urls table (if doesn't exists) with fields:
-//id INTEGER, shortId TEXT, statId TEXT, url TEXT, expirationDate TIME
-func CreateUrlsTableSqlite3(db *sql.DB, log *logrus.Logger) {
-
-	log.Info("Creating urls table")
+//Close calls Close method of *sql.DB
+func (d *dbdriver) Close() {
+	d.db.Close()
+}
 
-	checkTableSQL := "SELECT name FROM sqlite_master WHERE type='table' AND name='urls';"
-	row, err := db.Query(checkTableSQL)
-	if err != nil {
-		log.Fatal("Checking if urls table exists ", err)
-	}
-	defer row.Close()
-
-	urlsTabelExists := false
-	for row.Next() {
-		urlsTabelExists = true
-	}
-
-	if !urlsTabelExists {
-		createStudentTableSQL := `CREATE TABLE urls (
-			id		INTEGER PRIMARY KEY AUTOINCREMENT
-								UNIQUE
-								NOT NULL,
-			shortId	TEXT    NOT NULL
-								UNIQUE,
-			statId	TEXT    NOT NULL
-								UNIQUE,
-			url		TEXT    NOT NULL,
-			expirationDate TIME
-		);`
-
-		log.Info("Create urls table...")
-		statement, err := db.Prepare(createStudentTableSQL) // Prepare SQL Statement
-		if err != nil {
-			log.Fatal("Creating urls table ", err)
+//Ping checks that database is reachable and sqlite file still exists
+func (d *dbdriver) Ping(ctx context.Context) error {
+	if d.file != "" {
+		if _, err := os.Stat(d.file); err != nil {
+			return fmt.Errorf("database file is not available: %w", err)
 		}
-		_, err = statement.Exec()
-		if err != nil {
-			log.Fatal("can't create urls table", err)
-		}
-		log.Info("urls table created")
-	} else {
-		log.Info("urls table exists")
 	}
+
+	var one int
+	return d.db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
 }
 
-//CreateClicksTable creates clicks table (if doesn't exists) with fields:
-//shortId TEXT, IP TEXT, time TIME
-//clicks table collects stats for shortId
-func CreateClicksTableSqlite3(db *sql.DB, log *logrus.Logger) {
-	checkTableSQL := "SELECT name FROM sqlite_master WHERE type='table' AND name='clicks';"
-	row, err := db.Query(checkTableSQL)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer row.Close()
+//PoolStats returns statistics of connection pool
+func (d *dbdriver) PoolStats() sql.DBStats {
+	return d.db.Stats()
+}
 
-	urlsTabelExists := false
-	for row.Next() {
-		urlsTabelExists = true
+//GenerateShortUrl inserts new row into urls table
+//uses requested alias as shortId if it is set, otherwise derives shortId from row id
+//returns scheme with shortId and relative data
+func (d *dbdriver) GenerateShortUrl(ctx context.Context, url models.FullUrlScheme) (data *models.ShortLinkScheme, err error) {
+	data, err = d.generateShortUrl(ctx, url)
+	//concurrent request with the same idempotency key is committed by now, so its link is replayed
+	if errors.Is(err, models.ErrIdempotencyBusy) {
+		data, err = d.generateShortUrl(ctx, url)
 	}
 
-	if !urlsTabelExists {
-		createClicksTableSQL := `
-		CREATE TABLE clicks (
-			shortId TEXT NOT NULL
-						 REFERENCES urls (shortId) ON DELETE CASCADE,
-			IP      TEXT NOT NULL,
-			time    TIME NOT NULL
-		);`
-
-		log.Info("Create clicks table...")
-		statement, err := db.Prepare(createClicksTableSQL) // Prepare SQL Statement
-		if err != nil {
-			log.Fatal(err)
-		}
-		_, err = statement.Exec()
-		if err != nil {
-			log.Fatal("can't create clicks table", err)
-		}
-		log.Info("clicks table created")
-	} else {
-		log.Info("clicks table exists")
-	}
+	return data, err
 }
 
-//CreateUrlsTable creates urls table (if doesn't exists) with fields:
-//id INTEGER, shortId TEXT, statId TEXT, url TEXT, expirationDate TIME
-func CreateUrlsTablePostgres(db *sql.DB, log *logrus.Logger) {
+//generateShortUrl inserts link in its own transaction
+func (d *dbdriver) generateShortUrl(ctx context.Context, url models.FullUrlScheme) (data *models.ShortLinkScheme, err error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		d.log.Error(err)
+		return nil, err
+	}
 
-	log.Info("Creating urls table")
+	data, err = d.insertUrl(ctx, tx, url)
+	if err != nil {
+		d.rollback(tx)
+		return nil, err
+	}
 
-	checkTableSQL := "SELECT tablename FROM pg_tables WHERE tablename  = 'urls';"
-	row, err := db.Query(checkTableSQL)
+	err = tx.Commit()
 	if err != nil {
-		log.Fatal("Checking if urls table exists ", err)
-	}
-	defer row.Close()
-
-	urlsTabelExists := false
-	for row.Next() {
-		urlsTabelExists = true
-	}
-
-	if !urlsTabelExists {
-		createStudentTableSQL := `CREATE TABLE urls (
-			id		INTEGER PRIMARY KEY AUTOINCREMENT
-								UNIQUE
-								NOT NULL,
-			shortId	TEXT    NOT NULL
-								UNIQUE,
-			statId	TEXT    NOT NULL
-								UNIQUE,
-			url		TEXT    NOT NULL,
-			expirationDate TIME
-		);`
-
-		log.Info("Create urls table...")
-		statement, err := db.Prepare(createStudentTableSQL) // Prepare SQL Statement
-		if err != nil {
-			log.Fatal("Creating urls table ", err)
-		}
-		_, err = statement.Exec()
-		if err != nil {
-			log.Fatal("can't create urls table", err)
-		}
-		log.Info("urls table created")
-	} else {
-		log.Info("urls table exists")
+		d.log.Error(err)
+		d.rollback(tx)
+		return nil, err
 	}
+
+	return data, nil
 }
 
-//CreateClicksTable creates clicks table (if doesn't exists) with fields:
-//shortId TEXT, IP TEXT, time TIME
-//clicks table collects stats for shortId
-func CreateClicksTablePostgres(db *sql.DB, log *logrus.Logger) {
-	checkTableSQL := "SELECT tablename FROM pg_tables WHERE tablename  = 'clicks';"
-	row, err := db.Query(checkTableSQL)
+//GenerateShortUrls inserts batch of links in one transaction.
+//Invalid links and taken aliases fail their own rows only, any other error fails the whole batch
+func (d *dbdriver) GenerateShortUrls(ctx context.Context, urls []models.FullUrlScheme) (results []models.GenerateResult, err error) {
+	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Fatal(err)
+		d.log.Error(err)
+		return nil, err
 	}
-	defer row.Close()
 
-	urlsTabelExists := false
-	for row.Next() {
-		urlsTabelExists = true
+	results = make([]models.GenerateResult, len(urls))
+	for i, url := range urls {
+		data, err := d.insertUrl(ctx, tx, url)
+		if err != nil && !isRowError(err) {
+			d.rollback(tx)
+			return nil, err
+		}
+		results[i] = models.GenerateResult{Data: data, Err: err}
 	}
 
-	if !urlsTabelExists {
-		createClicksTableSQL := `
-		CREATE TABLE clicks (
-			shortId TEXT NOT NULL
-						 REFERENCES urls (shortId) ON DELETE CASCADE,
-			IP      TEXT NOT NULL,
-			time    TIME NOT NULL
-		);`
-
-		log.Info("Create clicks table...")
-		statement, err := db.Prepare(createClicksTableSQL) // Prepare SQL Statement
-		if err != nil {
-			log.Fatal(err)
-		}
-		_, err = statement.Exec()
-		if err != nil {
-			log.Fatal("can't create clicks table", err)
-		}
-		log.Info("clicks table created")
-	} else {
-		log.Info("clicks table exists")
+	err = tx.Commit()
+	if err != nil {
+		d.log.Error(err)
+		d.rollback(tx)
+		return nil, err
 	}
-}
 
-//Close calls Close method of *sql.DB
-func (d *dbdriver) Close() {
-	d.db.Close()
+	return results, nil
 }
 
-//GenerateShortUrl inserts new row into urls table
-//returns scheme with shortId and relative data
-func (d *dbdriver) GenerateShortUrl(url models.FullUrlScheme) (data *models.ShortLinkScheme, err error) {
+//isRowError checks if error is caused by link itself and leaves transaction usable
+func isRowError(err error) bool {
+	if errors.Is(err, models.ErrIdempotencyBusy) {
+		return false
+	}
+	return errors.Is(err, models.ErrInvalidInput) || errors.Is(err, models.ErrConflict)
+}
 
-	_, err = neturl.ParseRequestURI(url.Url)
+//insertUrl inserts new row into urls table within transaction.
+//Link saved for the same idempotency key or, in dedupe mode, existing active link to the same url is returned instead.
+//Alias is checked before insert, so taken alias doesn't abort transaction.
+//Alias taken by concurrent request between check and insert is rolled back to savepoint
+func (d *dbdriver) insertUrl(ctx context.Context, tx *sql.Tx, url models.FullUrlScheme) (data *models.ShortLinkScheme, err error) {
+	err = validateUrl(url.Url)
 	if err != nil {
 		d.log.Error(err)
 		return nil, err
 	}
 
+	if url.NormalizedUrl == "" {
+		url.NormalizedUrl = url.Url
+	}
+
+	if url.IdempotencyKey != "" {
+		data, err = d.idempotentResult(ctx, tx, url)
+		if err != nil || data != nil {
+			return data, err
+		}
+	}
+
+	if url.Dedupe && url.Alias == "" {
+		var urlId int64
+		urlId, data, err = d.findActiveLink(ctx, tx, url.NormalizedUrl, url.OwnerKeyId)
+		if err != nil {
+			d.log.Error(err)
+			return nil, err
+		}
+		if data != nil {
+			if url.IdempotencyKey != "" {
+				err = d.saveIdempotencyKey(ctx, tx, url, urlId)
+			}
+			return data, err
+		}
+	}
+
 	statId := NewStatKey()
 	shortId := statId
+	if url.Alias != "" {
+		shortId = url.Alias
+	}
 
 	d.log.Info("Inserting url record ", statId)
 
-	tx, err := d.db.Begin()
+	if url.Alias != "" {
+		taken, err := d.shortIdExists(ctx, tx, shortId)
+		if err != nil {
+			d.log.Error(err)
+			return nil, err
+		}
+		if taken {
+			return nil, fmt.Errorf("%w: '%s'", models.ErrAliasTaken, shortId)
+		}
+	}
+
+	expirationDate, err := getExpirationDate(url)
 	if err != nil {
 		d.log.Error(err)
 		return nil, err
 	}
 
-	expirationDate := time.Now().AddDate(0, 1, 0)
+	ownerKeyId := sql.NullInt64{Int64: url.OwnerKeyId, Valid: url.OwnerKeyId != 0}
 
-	insertSQL := `INSERT INTO urls(statId, shortId, url, expirationDate) VALUES (?, ?, ?, ?)`
-	sqlResult, err := tx.Exec(insertSQL, statId, shortId, url.Url, expirationDate)
-	if err != nil {
-		d.log.Error(err)
-		err = tx.Rollback()
+	if url.Alias != "" {
+		_, err = tx.ExecContext(ctx, `SAVEPOINT insert_alias`)
 		if err != nil {
-			d.log.Fatal(err)
+			d.log.Error(err)
+			return nil, err
 		}
-		return nil, err
 	}
 
-	LastInsertedId, err := sqlResult.LastInsertId()
+	insertSQL := `INSERT INTO urls(statId, shortId, url, expirationDate, ownerKeyId, createdAt, normalizedUrl, host) VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	var lastInsertedId int64
+	err = tx.QueryRowContext(ctx, d.dialect.rebind(insertSQL), statId, shortId, url.Url, expirationDate, ownerKeyId, time.Now().UTC(), url.NormalizedUrl,
+		urlHost(url.Url)).Scan(&lastInsertedId)
+	if url.Alias != "" && isUniqueViolation(err) {
+		_, rollbackErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT insert_alias`)
+		if rollbackErr != nil {
+			d.log.Error(rollbackErr)
+			return nil, rollbackErr
+		}
+		return nil, fmt.Errorf("%w: '%s'", models.ErrAliasTaken, shortId)
+	}
 	if err != nil {
 		d.log.Error(err)
-		err = tx.Rollback()
-		if err != nil {
-			d.log.Fatal(err)
-		}
 		return nil, err
 	}
 
-	shortId = getShortId(LastInsertedId)
-	updateSql := `UPDATE urls SET shortId = ? WHERE id = ?`
-	_, err = tx.Exec(updateSql, shortId, LastInsertedId)
-	if err != nil {
-		d.log.Error(err)
-		err = tx.Rollback()
+	if url.Alias == "" {
+		shortId = getShortId(lastInsertedId)
+
+		//generated id may be already taken by somebody's alias
+		taken, err := d.shortIdExists(ctx, tx, shortId)
 		if err != nil {
-			d.log.Fatal(err)
+			d.log.Error(err)
+			return nil, err
+		}
+		if taken {
+			shortId = NewStatKey()
+		}
+
+		updateSql := `UPDATE urls SET shortId = ? WHERE id = ?`
+		_, err = tx.ExecContext(ctx, d.dialect.rebind(updateSql), shortId, lastInsertedId)
+		if err != nil {
+			d.log.Error(err)
+			return nil, err
 		}
-		return nil, err
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		d.log.Error(err)
-		err = tx.Rollback()
+	if url.IdempotencyKey != "" {
+		err = d.saveIdempotencyKey(ctx, tx, url, lastInsertedId)
 		if err != nil {
-			d.log.Fatal(err)
+			d.log.Error(err)
+			return nil, err
 		}
-		return nil, err
 	}
 
-	result := &models.ShortLinkScheme{
-		FullUrl:        url.Url,
-		ShortId:        shortId,
-		StatId:         statId,
-		ExpirationDate: expirationDate.Format("2006-01-02"),
+	return shortLink(shortId, statId, url.Url, dbTime{Time: expirationDate.Time, Valid: expirationDate.Valid}), nil
+}
+
+//validateUrl checks that url can be used as redirect target
+func validateUrl(url string) error {
+	return urlnorm.Check(url)
+}
+
+//getExpirationDate returns expiration date requested in RFC3339 format converted to UTC
+//and NULL for never expiring links. Default TTL is applied by repo, so date must be set
+func getExpirationDate(url models.FullUrlScheme) (sql.NullTime, error) {
+	if url.NeverExpires {
+		return sql.NullTime{}, nil
+	}
+
+	if url.ExpirationDate == "" {
+		return sql.NullTime{}, fmt.Errorf("%w: expiration date isn't set", models.ErrInvalidExpiration)
+	}
+
+	expirationDate, err := time.Parse(time.RFC3339, url.ExpirationDate)
+	if err != nil {
+		return sql.NullTime{}, fmt.Errorf("%w: %v", models.ErrInvalidExpiration, err)
 	}
 
-	return result, nil
+	return sql.NullTime{Time: expirationDate.UTC(), Valid: true}, nil
 }
 
-//GetFullUrl converts short id into full url
-func (d *dbdriver) GetFullUrl(shortId string) (urlScheme *models.FullUrlScheme, err error) {
-	query := `select url from urls WHERE shortId = ?`
-	rows := d.db.QueryRow(query, shortId)
+//rollback rolls back transaction, failed rollback is fatal
+func (d *dbdriver) rollback(tx *sql.Tx) {
+	err := tx.Rollback()
+	if err != nil && err != sql.ErrTxDone {
+		d.log.Fatal(err)
+	}
+}
+
+//shortIdExists checks if shortId is already used by urls table row
+func (d *dbdriver) shortIdExists(ctx context.Context, tx *sql.Tx, shortId string) (bool, error) {
+	query := `SELECT COUNT(*) FROM urls WHERE shortId = ?`
+	var count int64
+	err := tx.QueryRowContext(ctx, d.dialect.rebind(query), shortId).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+//GetFullUrl converts short id into full url with its expiration
+//returns models.ErrLinkExpired if link's expiration date has passed
+func (d *dbdriver) GetFullUrl(ctx context.Context, shortId string) (urlScheme *models.FullUrlScheme, err error) {
+	query := `select url, expirationDate from urls WHERE shortId = ?`
+	rows := d.db.QueryRowContext(ctx, d.dialect.rebind(query), shortId)
 
 	var fullUrl string
-	err = rows.Scan(&fullUrl)
+	var expirationDate dbTime
+	err = rows.Scan(&fullUrl, &expirationDate)
 
 	if err == sql.ErrNoRows {
-		error := errors.New("short url doesn't exist")
-		d.log.Error(error)
-		return nil, error
+		d.log.Error(models.ErrLinkNotFound)
+		return nil, models.ErrLinkNotFound
 	} else if err != nil {
 		d.log.Error(err)
 		return nil, err
 	}
 
-	urlScheme = &models.FullUrlScheme{Url: fullUrl}
+	if expirationDate.Valid && !expirationDate.Time.After(time.Now()) {
+		return nil, fmt.Errorf("%w: '%s' expired at %s", models.ErrLinkExpired, shortId, expirationDate.Time.Format("2006-01-02 15:04:05"))
+	}
+
+	urlScheme = &models.FullUrlScheme{Url: fullUrl, NeverExpires: !expirationDate.Valid}
+	if expirationDate.Valid {
+		urlScheme.ExpirationDate = expirationDate.Time.Format(time.RFC3339)
+	}
 
 	return urlScheme, nil
 }
 
-//RegisterClick inserts new row into clicks table
-func (d *dbdriver) RegisterClick(shortId string, ip string) (err error) {
-	insertSQL := `INSERT INTO clicks(shortId, IP, time) VALUES (?, ?, ?)`
-	_, err = d.db.Exec(insertSQL, shortId, ip, time.Now())
+//RegisterClicks inserts batch of clicks into clicks table and adds them to hourly counters in one transaction
+func (d *dbdriver) RegisterClicks(ctx context.Context, clicks []models.ClickEvent) (err error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		d.log.Error(err)
+		return err
+	}
 
+	insertSQL := `INSERT INTO clicks(shortId, IP, time, referrer, referrerHost, userAgent, language, browser, os, device, isBot,
+			country, region, city)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	statement, err := tx.Prepare(d.dialect.rebind(insertSQL))
 	if err != nil {
 		d.log.Error(err)
+		d.rollback(tx)
+		return err
+	}
+	defer statement.Close()
+
+	for _, click := range clicks {
+		_, err = statement.ExecContext(ctx, click.ShortId, click.IP, click.Time.UTC(), click.Referrer, click.ReferrerHost,
+			click.UserAgent, click.Language, click.Browser, click.OS, click.Device, click.Bot,
+			click.Country, click.Region, click.City)
+		if err != nil {
+			d.log.Error(err)
+			d.rollback(tx)
+			return err
+		}
+	}
+
+	err = d.updateRollups(ctx, tx, clicks)
+	if err != nil {
+		d.log.Error(err)
+		d.rollback(tx)
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		d.log.Error(err)
+		d.rollback(tx)
 	}
 
 	return err
 }
 
-//GetStats return stats scheme for short link using statId
-func (d *dbdriver) GetStats(statId string) (ss *models.StatsScheme, err error) {
-	query := `SELECT urls.ShortID, MAX(urls.expirationDate) as expirationDate, COALESCE(count(clicks.ShortId),0) as clickCount From urls 
+//GetStats return stats scheme for short link using statId, clicks of bots are left out of it if filter excludes them
+func (d *dbdriver) GetStats(ctx context.Context, statId string, filter models.StatsFilter) (ss *models.StatsScheme, err error) {
+	query := `SELECT urls.ShortID, MAX(urls.expirationDate) as expirationDate, COALESCE(count(clicks.ShortId),0) as clickCount,
+				COALESCE(SUM(CASE WHEN clicks.isBot THEN 1 ELSE 0 END),0) as botCount From urls 
 			LEFT JOIN clicks
 				ON urls.shortId = clicks.ShortId 
 			WHERE urls.statId = ?
 			GROUP BY urls.ShortID`
-	row := d.db.QueryRow(query, statId)
+	row := d.db.QueryRowContext(ctx, d.dialect.rebind(query), statId)
 
 	var shortID string
-	var expirationDateStr string
-	var clicksCount int64
-	err = row.Scan(&shortID, &expirationDateStr, &clicksCount)
+	var expirationDate dbTime
+	var clicksCount, botCount int64
+	err = row.Scan(&shortID, &expirationDate, &clicksCount, &botCount)
 	if err == sql.ErrNoRows {
-		error := errors.New("stat url doesn't exist")
-		d.log.Error(error)
-		return nil, error
+		d.log.Error(models.ErrStatNotFound)
+		return nil, models.ErrStatNotFound
 	} else if err != nil {
 		d.log.Error(err)
 		return nil, err
 	}
 
-	expirationDate, _ := time.Parse("2006-01-02 15:04:05.999999999-07:00", expirationDateStr)
+	clicksCondition := ""
+	if filter.ExcludeBots {
+		clicksCondition = " AND NOT isBot"
+	}
 
-	query = `SELECT IP, Time FROM clicks WHERE ShortId = ? ORDER BY Time DESC LIMIT 100`
-	rows, err := d.db.Query(query, shortID)
+	query = `SELECT IP, Time, referrer, referrerHost, userAgent, language, browser, os, device, isBot, country, region, city
+		FROM clicks WHERE ShortId = ?` + clicksCondition + ` ORDER BY Time DESC LIMIT 100`
+	rows, err := d.db.QueryContext(ctx, d.dialect.rebind(query), shortID)
+	if err != nil {
+		d.log.Error(err)
+		return nil, err
+	}
 
 	var clicks []*models.ClickScheme
 	defer rows.Close()
 	for rows.Next() {
 		var ip string
-		var timeString string
+		var clickTime dbTime
+		var details models.ClickDetails
 
-		err := rows.Scan(&ip, &timeString)
+		err := rows.Scan(&ip, &clickTime, &details.Referrer, &details.ReferrerHost, &details.UserAgent,
+			&details.Language, &details.Browser, &details.OS, &details.Device, &details.Bot,
+			&details.Country, &details.Region, &details.City)
 		if err != nil {
 			d.log.Error(err)
 		}
 
-		time, _ := time.Parse("2006-01-02 15:04:05.999999999-07:00", timeString)
 		click := &models.ClickScheme{
-			IP:   ip,
-			Time: time.Format("2006-01-02 15:04:05"),
+			IP:           ip,
+			Time:         clickTime.Time.Format("2006-01-02 15:04:05"),
+			ClickDetails: details,
 		}
 		clicks = append(clicks, click)
 	}
 
+	uniqueVisitors, err := d.uniqueVisitors(ctx, shortID)
+	if err != nil {
+		d.log.Error(err)
+		return nil, err
+	}
+
 	ss = &models.StatsScheme{
 		ClickCount:     clicksCount,
-		ExpirationDate: expirationDate.Format("2006-01-02"),
+		HumanClicks:    clicksCount - botCount,
+		BotClicks:      botCount,
+		UniqueVisitors: uniqueVisitors,
 		Clicks:         clicks,
 	}
+	if filter.ExcludeBots {
+		ss.ClickCount = ss.HumanClicks
+	}
+	if expirationDate.Valid {
+		ss.ExpirationDate = expirationDate.Time.Format("2006-01-02")
+	}
+
+	breakdowns := []struct {
+		column string
+		counts *[]*models.CountScheme
+	}{
+		{"referrerHost", &ss.Referrers},
+		{"browser", &ss.Browsers},
+		{"os", &ss.OperatingSystems},
+		{"device", &ss.Devices},
+		{"language", &ss.Languages},
+		{"country", &ss.Countries},
+	}
+	for _, b := range breakdowns {
+		*b.counts, err = d.breakdown(ctx, shortID, b.column, clicksCondition)
+		if err != nil {
+			d.log.Error(err)
+			return nil, err
+		}
+	}
 
 	return ss, nil
 }
 
+//breakdownSize is number of the most frequent values in stats breakdowns
+const breakdownSize = 20
+
+//breakdown counts clicks of shortId matching condition by values of clicks' column
+func (d *dbdriver) breakdown(ctx context.Context, shortId string, column string, condition string) ([]*models.CountScheme, error) {
+	query := fmt.Sprintf(`SELECT %[1]s, COUNT(*) FROM clicks WHERE shortId = ?%[3]s
+		GROUP BY %[1]s ORDER BY COUNT(*) DESC, %[1]s LIMIT %[2]d`, column, breakdownSize, condition)
+	rows, err := d.db.QueryContext(ctx, d.dialect.rebind(query), shortId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*models.CountScheme
+	for rows.Next() {
+		count := &models.CountScheme{}
+		err = rows.Scan(&count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
 func getShortId(value int64) string {
 	bi := big.NewInt(value)
 	slice := bi.Bytes()
@@ -377,3 +499,92 @@ func bytesToKey(src *[]byte) string {
 	encodedString = strings.TrimRight(encodedString, "=")
 	return strings.Replace(encodedString, "/", "-", -1)
 }
+
+//DeleteExpiredClicks deletes at most batchSize clicks of links expired before now
+//returns number of deleted rows
+func (d *dbdriver) DeleteExpiredClicks(ctx context.Context, now time.Time, batchSize int) (int64, error) {
+	deleteSQL := fmt.Sprintf(`DELETE FROM clicks WHERE %[1]s IN (
+			SELECT clicks.%[1]s FROM clicks
+				INNER JOIN urls
+					ON urls.shortId = clicks.shortId
+			WHERE urls.expirationDate < ?
+			LIMIT ?)`, d.dialect.rowId)
+
+	return d.deleteBatch(ctx, deleteSQL, now.UTC(), batchSize)
+}
+
+//DeleteExpiredUrls deletes at most batchSize links expired before now with their idempotency keys
+//returns number of deleted links
+func (d *dbdriver) DeleteExpiredUrls(ctx context.Context, now time.Time, batchSize int) (int64, error) {
+	expiredSQL := `SELECT id FROM urls
+			WHERE expirationDate < ?
+			ORDER BY id
+			LIMIT ?`
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		d.log.Error(err)
+		return 0, err
+	}
+
+	deleteSQL := `DELETE FROM idempotency_keys WHERE urlId IN (` + expiredSQL + `)`
+	_, err = tx.ExecContext(ctx, d.dialect.rebind(deleteSQL), now.UTC(), batchSize)
+	if err != nil {
+		d.log.Error(err)
+		d.rollback(tx)
+		return 0, err
+	}
+
+	deleteSQL = `DELETE FROM urls WHERE id IN (` + expiredSQL + `)`
+	sqlResult, err := tx.ExecContext(ctx, d.dialect.rebind(deleteSQL), now.UTC(), batchSize)
+	if err != nil {
+		d.log.Error(err)
+		d.rollback(tx)
+		return 0, err
+	}
+
+	deleted, err := sqlResult.RowsAffected()
+	if err != nil {
+		d.log.Error(err)
+		d.rollback(tx)
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		d.log.Error(err)
+		d.rollback(tx)
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+//DeleteClicksBefore deletes at most batchSize clicks registered before given time
+//returns number of deleted rows
+func (d *dbdriver) DeleteClicksBefore(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	deleteSQL := fmt.Sprintf(`DELETE FROM clicks WHERE %[1]s IN (
+			SELECT %[1]s FROM clicks
+			WHERE time < ?
+			LIMIT ?)`, d.dialect.rowId)
+
+	return d.deleteBatch(ctx, deleteSQL, before.UTC(), batchSize)
+}
+
+//deleteBatch runs delete statement taking boundary of deleted rows and batch size,
+//time boundaries must be in UTC as times are stored in UTC
+func (d *dbdriver) deleteBatch(ctx context.Context, deleteSQL string, boundary interface{}, batchSize int) (int64, error) {
+	sqlResult, err := d.db.ExecContext(ctx, d.dialect.rebind(deleteSQL), boundary, batchSize)
+	if err != nil {
+		d.log.Error(err)
+		return 0, err
+	}
+
+	deleted, err := sqlResult.RowsAffected()
+	if err != nil {
+		d.log.Error(err)
+		return 0, err
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,84 @@
+//Package geoip finds country, region and city of ip in a local MaxMind database (.mmdb),
+//GeoLite2 and GeoIP2 Country and City databases and others of the same structure are supported
+package geoip
+
+import (
+	"net"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/sirupsen/logrus"
+
+	"urlshortener/internal/models"
+)
+
+//language of region and city names
+const language = "en"
+
+//record is the part of database's record describing location
+type record struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+//Locator looks ips up in database file which is kept open till Close
+type Locator struct {
+	log    *logrus.Logger
+	reader *maxminddb.Reader
+}
+
+//Open opens database at path
+func Open(log *logrus.Logger, path string) (*Locator, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	built := time.Unix(int64(reader.Metadata.BuildEpoch), 0).Format("2006-01-02")
+	log.Infof("GeoIP database %s of %s built on %s is opened", reader.Metadata.DatabaseType, path, built)
+	return &Locator{log: log, reader: reader}, nil
+}
+
+//Locate returns location of ip, it's empty for invalid, private and unknown ips.
+//Region is the largest subdivision of country, names are in English
+func (l *Locator) Locate(ip string) models.GeoLocation {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return models.GeoLocation{}
+	}
+
+	var r record
+	err := l.reader.Lookup(parsed, &r)
+	if err != nil {
+		l.log.Debugf("GeoIP can't locate %s, got %v", ip, err)
+		return models.GeoLocation{}
+	}
+
+	location := models.GeoLocation{
+		Country: r.Country.IsoCode,
+		City:    r.City.Names[language],
+	}
+	if location.Country == "" {
+		location.Country = r.RegisteredCountry.IsoCode
+	}
+	if len(r.Subdivisions) > 0 {
+		location.Region = r.Subdivisions[0].Names[language]
+	}
+
+	return location
+}
+
+//Close closes database
+func (l *Locator) Close() error {
+	return l.reader.Close()
+}
@@ -0,0 +1,50 @@
+package geoip
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/models"
+)
+
+func names(name string) map[string]interface{} {
+	return map[string]interface{}{"en": name, "de": name + " (de)"}
+}
+
+func TestLocate(t *testing.T) {
+	path := writeDatabase(t, map[string]interface{}{
+		"81.2.69.0/24": map[string]interface{}{
+			"country":      map[string]interface{}{"iso_code": "GB", "names": names("United Kingdom")},
+			"subdivisions": []interface{}{map[string]interface{}{"iso_code": "ENG", "names": names("England")}},
+			"city":         map[string]interface{}{"names": names("London")},
+		},
+		"89.160.20.112/28": map[string]interface{}{
+			"country": map[string]interface{}{"iso_code": "SE"},
+		},
+		"2.125.160.216/29": map[string]interface{}{
+			"registered_country": map[string]interface{}{"iso_code": "FR"},
+		},
+	})
+
+	l, err := Open(logrus.New(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	assert.Equal(t, models.GeoLocation{Country: "GB", Region: "England", City: "London"}, l.Locate("81.2.69.160"))
+	assert.Equal(t, models.GeoLocation{Country: "SE"}, l.Locate("89.160.20.120"))
+	assert.Equal(t, models.GeoLocation{Country: "FR"}, l.Locate("2.125.160.217"))
+	assert.Equal(t, models.GeoLocation{}, l.Locate("89.160.20.100"))
+	assert.Equal(t, models.GeoLocation{}, l.Locate("10.0.0.1"))
+	assert.Equal(t, models.GeoLocation{}, l.Locate("2001:db8::1"))
+	assert.Equal(t, models.GeoLocation{}, l.Locate("undefined"))
+}
+
+func TestOpen(t *testing.T) {
+	_, err := Open(logrus.New(), filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.Error(t, err)
+}
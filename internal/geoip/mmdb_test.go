@@ -0,0 +1,183 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+//Minimal writer of MaxMind DB format for fixtures, see https://maxmind.github.io/MaxMind-DB/.
+//It writes IPv4 databases with 24-bit records of maps, arrays, strings and unsigned integers
+
+type uint16Value uint16
+type uint32Value uint32
+type uint64Value uint64
+
+const (
+	typeString = 2
+	typeUint16 = 5
+	typeUint32 = 6
+	typeMap    = 7
+	typeUint64 = 9
+	typeArray  = 11
+)
+
+//encodeControl writes control byte with type and size, extended types take one more byte
+func encodeControl(buf *bytes.Buffer, typeNum int, size int) {
+	var sizeBits byte
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		sizeBits = byte(size)
+	case size < 29+256:
+		sizeBits, sizeBytes = 29, []byte{byte(size - 29)}
+	case size < 285+65536:
+		sizeBits, sizeBytes = 30, []byte{byte((size - 285) >> 8), byte(size - 285)}
+	default:
+		panic("value is too big for fixture")
+	}
+
+	if typeNum > 7 {
+		buf.WriteByte(sizeBits)
+		buf.WriteByte(byte(typeNum - 7))
+	} else {
+		buf.WriteByte(byte(typeNum)<<5 | sizeBits)
+	}
+	buf.Write(sizeBytes)
+}
+
+func encodeUint(buf *bytes.Buffer, typeNum int, value uint64) {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], value)
+	trimmed := bytes.TrimLeft(data[:], "\x00")
+	encodeControl(buf, typeNum, len(trimmed))
+	buf.Write(trimmed)
+}
+
+func encode(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		encodeControl(buf, typeString, len(v))
+		buf.WriteString(v)
+	case uint16Value:
+		encodeUint(buf, typeUint16, uint64(v))
+	case uint32Value:
+		encodeUint(buf, typeUint32, uint64(v))
+	case uint64Value:
+		encodeUint(buf, typeUint64, uint64(v))
+	case []interface{}:
+		encodeControl(buf, typeArray, len(v))
+		for _, item := range v {
+			encode(buf, item)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		encodeControl(buf, typeMap, len(v))
+		for _, key := range keys {
+			encode(buf, key)
+			encode(buf, v[key])
+		}
+	default:
+		panic("unsupported fixture value")
+	}
+}
+
+//treeNode has a subtree or data offset plus one for each bit, zero is no data
+type treeNode struct {
+	children [2]*treeNode
+	data     [2]int
+	id       int
+}
+
+//writeDatabase writes IPv4 database of records by CIDR into temporary directory and returns its path
+func writeDatabase(t *testing.T, records map[string]interface{}) string {
+	var data bytes.Buffer
+	root := &treeNode{}
+
+	cidrs := make([]string, 0, len(records))
+	for cidr := range records {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := network.Mask.Size()
+		ip := network.IP.To4()
+
+		offset := data.Len()
+		encode(&data, records[cidr])
+
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> (7 - uint(i%8)) & 1
+			if i == ones-1 {
+				node.data[bit] = offset + 1
+				break
+			}
+			if node.children[bit] == nil {
+				node.children[bit] = &treeNode{}
+			}
+			node = node.children[bit]
+		}
+	}
+
+	var nodes []*treeNode
+	queue := []*treeNode{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		node.id = len(nodes)
+		nodes = append(nodes, node)
+		for _, child := range node.children {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	var db bytes.Buffer
+	for _, node := range nodes {
+		for bit := 0; bit < 2; bit++ {
+			record := len(nodes)
+			if node.children[bit] != nil {
+				record = node.children[bit].id
+			} else if node.data[bit] != 0 {
+				record = len(nodes) + 16 + node.data[bit] - 1
+			}
+			db.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+	db.Write(make([]byte, 16))
+	db.Write(data.Bytes())
+	db.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encode(&db, map[string]interface{}{
+		"binary_format_major_version": uint16Value(2),
+		"binary_format_minor_version": uint16Value(0),
+		"build_epoch":                 uint64Value(1704067200),
+		"database_type":               "Test-City",
+		"description":                 map[string]interface{}{"en": "test fixture"},
+		"ip_version":                  uint16Value(4),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint32Value(len(nodes)),
+		"record_size":                 uint16Value(24),
+	})
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	err := os.WriteFile(path, db.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
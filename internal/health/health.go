@@ -0,0 +1,133 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOk   = "ok"
+	StatusFail = "fail"
+)
+
+//ErrShuttingDown is reported once application started to shut down
+var ErrShuttingDown = errors.New("shutting down")
+
+//Check tells if component is able to serve requests, it must give up when ctx is done
+type Check func(ctx context.Context) error
+
+//ComponentStatus is a result of component's check
+type ComponentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+//Report is a result of readiness check. Application is ready when all of its components are
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+//Ready tells if all components passed their checks
+func (r Report) Ready() bool {
+	return r.Status == StatusOk
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+//Checker runs readiness checks of application components
+type Checker struct {
+	timeout      time.Duration
+	shuttingDown uint32
+	mu           sync.RWMutex
+	checks       []namedCheck
+}
+
+//NewChecker creates checker giving every check no more than timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+//Add registers check of component, adding the same name twice panics
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, nc := range c.checks {
+		if nc.name == name {
+			panic("health check " + name + " is already registered")
+		}
+	}
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+	sort.Slice(c.checks, func(i, j int) bool { return c.checks[i].name < c.checks[j].name })
+}
+
+//ShutDown makes checker report that application is not ready anymore, so load balancers stop sending traffic
+func (c *Checker) ShutDown() {
+	atomic.StoreUint32(&c.shuttingDown, 1)
+}
+
+//Check runs all checks concurrently and reports status of every component
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			errs[i] = run(ctx, check)
+		}(i, nc.check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOk, Components: make(map[string]ComponentStatus, len(checks)+1)}
+	for i, nc := range checks {
+		report.Components[nc.name] = status(errs[i])
+		if errs[i] != nil {
+			report.Status = StatusFail
+		}
+	}
+
+	if atomic.LoadUint32(&c.shuttingDown) == 1 {
+		report.Components["shutdown"] = status(ErrShuttingDown)
+		report.Status = StatusFail
+	}
+
+	return report
+}
+
+//run waits for check until ctx is done, so check ignoring ctx can't hold the report
+func run(ctx context.Context, check Check) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- check(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func status(err error) ComponentStatus {
+	if err != nil {
+		return ComponentStatus{Status: StatusFail, Error: err.Error()}
+	}
+	return ComponentStatus{Status: StatusOk}
+}
@@ -0,0 +1,52 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	c := NewChecker(50 * time.Millisecond)
+	c.Add("database", func(ctx context.Context) error { return nil })
+	c.Add("cache", func(ctx context.Context) error { return errors.New("connection refused") })
+	c.Add("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	report := c.Check(context.Background())
+	assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+
+	assert.False(t, report.Ready())
+	assert.Equal(t, ComponentStatus{Status: StatusOk}, report.Components["database"])
+	assert.Equal(t, ComponentStatus{Status: StatusFail, Error: "connection refused"}, report.Components["cache"])
+	assert.Equal(t, ComponentStatus{Status: StatusFail, Error: context.DeadlineExceeded.Error()}, report.Components["slow"])
+}
+
+func TestShutDown(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("database", func(ctx context.Context) error { return nil })
+
+	report := c.Check(context.Background())
+	assert.True(t, report.Ready())
+	assert.Len(t, report.Components, 1)
+
+	c.ShutDown()
+	report = c.Check(context.Background())
+	assert.False(t, report.Ready())
+	assert.Equal(t, StatusFail, report.Components["shutdown"].Status)
+	assert.Equal(t, StatusOk, report.Components["database"].Status)
+}
+
+func TestAddTwicePanics(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("database", func(ctx context.Context) error { return nil })
+	assert.Panics(t, func() {
+		c.Add("database", func(ctx context.Context) error { return nil })
+	})
+}
@@ -0,0 +1,139 @@
+//Package hll estimates number of distinct items with HyperLogLog sketches of bounded size
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+//precision gives 4096 registers and about 1.6% standard error
+const precision = 12
+const registers = 1 << precision
+
+//Encodings of marshaled sketch, sparse one lists non empty registers as 2 bytes index and 1 byte value
+const (
+	encodingSparse = 1
+	encodingDense  = 2
+)
+
+var ErrInvalidSketch = errors.New("invalid hyperloglog sketch")
+
+//Sketch is a HyperLogLog sketch of 64-bit hashes, zero value is empty sketch
+type Sketch struct {
+	registers []uint8
+}
+
+//Add adds item's hash, hashes must be uniformly distributed
+func (s *Sketch) Add(hash uint64) {
+	if s.registers == nil {
+		s.registers = make([]uint8, registers)
+	}
+
+	index := hash >> (64 - precision)
+	rank := uint8(bits.LeadingZeros64(hash<<precision|1<<(precision-1)) + 1)
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+	}
+}
+
+//Merge adds items of other sketch
+func (s *Sketch) Merge(other *Sketch) {
+	if other == nil || other.registers == nil {
+		return
+	}
+	if s.registers == nil {
+		s.registers = make([]uint8, registers)
+	}
+
+	for i, rank := range other.registers {
+		if rank > s.registers[i] {
+			s.registers[i] = rank
+		}
+	}
+}
+
+//Estimate returns estimated number of distinct items
+func (s *Sketch) Estimate() int64 {
+	if s.registers == nil {
+		return 0
+	}
+
+	sum := 0.0
+	zeros := 0
+	for _, rank := range s.registers {
+		sum += 1 / float64(uint64(1)<<rank)
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	m := float64(registers)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		//linear counting is more precise for small numbers
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return int64(math.Round(estimate))
+}
+
+//MarshalBinary encodes sketch, sketches with few items are encoded sparsely and empty one is nil
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	if s.registers == nil {
+		return nil, nil
+	}
+
+	var used int
+	for _, rank := range s.registers {
+		if rank != 0 {
+			used++
+		}
+	}
+
+	if used*3 >= registers {
+		return append([]byte{encodingDense}, s.registers...), nil
+	}
+
+	data := make([]byte, 1, 1+used*3)
+	data[0] = encodingSparse
+	for i, rank := range s.registers {
+		if rank != 0 {
+			data = append(data, byte(i>>8), byte(i), rank)
+		}
+	}
+	return data, nil
+}
+
+//UnmarshalBinary decodes sketch encoded by MarshalBinary, empty data is empty sketch
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	s.registers = nil
+	if len(data) == 0 {
+		return nil
+	}
+
+	switch data[0] {
+	case encodingDense:
+		if len(data) != 1+registers {
+			return ErrInvalidSketch
+		}
+		s.registers = append([]uint8(nil), data[1:]...)
+	case encodingSparse:
+		if (len(data)-1)%3 != 0 {
+			return ErrInvalidSketch
+		}
+		s.registers = make([]uint8, registers)
+		for i := 1; i < len(data); i += 3 {
+			index := binary.BigEndian.Uint16(data[i:])
+			if int(index) >= registers {
+				return ErrInvalidSketch
+			}
+			s.registers[index] = data[i+2]
+		}
+	default:
+		return ErrInvalidSketch
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package hll
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hash(item string) uint64 {
+	sum := sha256.Sum256([]byte(item))
+	return binary.BigEndian.Uint64(sum[:])
+}
+
+func TestEstimate(t *testing.T) {
+	var empty Sketch
+	assert.Equal(t, int64(0), empty.Estimate())
+
+	for _, n := range []int{1, 10, 100, 1000, 10000, 100000} {
+		var s Sketch
+		for i := 0; i < n; i++ {
+			s.Add(hash(strconv.Itoa(i)))
+			s.Add(hash(strconv.Itoa(i)))
+		}
+		assert.InEpsilon(t, n, s.Estimate(), 0.05, n)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	var a, b Sketch
+	for i := 0; i < 3000; i++ {
+		a.Add(hash(strconv.Itoa(i)))
+	}
+	for i := 2000; i < 5000; i++ {
+		b.Add(hash(strconv.Itoa(i)))
+	}
+
+	var union Sketch
+	union.Merge(&a)
+	union.Merge(&b)
+	union.Merge(nil)
+	union.Merge(&Sketch{})
+	assert.InEpsilon(t, 5000, union.Estimate(), 0.05)
+}
+
+func TestMarshal(t *testing.T) {
+	for _, n := range []int{0, 5, 5000} {
+		var s Sketch
+		for i := 0; i < n; i++ {
+			s.Add(hash(strconv.Itoa(i)))
+		}
+
+		data, err := s.MarshalBinary()
+		assert.NoError(t, err)
+		switch n {
+		case 0:
+			assert.Nil(t, data)
+		case 5:
+			assert.Len(t, data, 1+5*3)
+		}
+
+		var decoded Sketch
+		assert.NoError(t, decoded.UnmarshalBinary(data))
+		assert.Equal(t, s.Estimate(), decoded.Estimate())
+	}
+
+	var s Sketch
+	assert.NoError(t, s.UnmarshalBinary(nil))
+	assert.Error(t, s.UnmarshalBinary([]byte{encodingSparse, 1}))
+	assert.Error(t, s.UnmarshalBinary([]byte{encodingSparse, 0xff, 0xff, 1}))
+	assert.Error(t, s.UnmarshalBinary([]byte{encodingDense, 1}))
+	assert.Error(t, s.UnmarshalBinary([]byte{9}))
+}
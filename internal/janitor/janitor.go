@@ -0,0 +1,173 @@
+package janitor
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//pause between batches lets other connections take the database lock
+const batchPause = 50 * time.Millisecond
+
+//visitorSaltTTL keeps salts of today and yesterday, clicks may wait in queue a bit past midnight
+const visitorSaltTTL = 48 * time.Hour
+
+type Storage interface {
+	DeleteExpiredClicks(ctx context.Context, now time.Time, batchSize int) (int64, error)
+	DeleteExpiredRollups(ctx context.Context, now time.Time, batchSize int) (int64, error)
+	DeleteExpiredUrls(ctx context.Context, now time.Time, batchSize int) (int64, error)
+	DeleteClicksBefore(ctx context.Context, before time.Time, batchSize int) (int64, error)
+	DeleteIdempotencyKeysBefore(ctx context.Context, before time.Time, batchSize int) (int64, error)
+	DeleteVisitorSaltsBefore(ctx context.Context, before time.Time, batchSize int) (int64, error)
+}
+
+//Config holds janitor's schedule and retention policy.
+//Clicks older than ClickRetention are deleted, zero ClickRetention keeps click history forever.
+//Idempotency keys older than IdempotencyKeyTTL are deleted, zero IdempotencyKeyTTL keeps them forever
+type Config struct {
+	Interval          time.Duration
+	ClickRetention    time.Duration
+	IdempotencyKeyTTL time.Duration
+	BatchSize         int
+}
+
+//Janitor periodically purges expired links with their clicks and old clicks
+type Janitor struct {
+	//counters go first to be 64-bit aligned for atomic operations
+	sweeps        uint64
+	deletedUrls   uint64
+	deletedClicks uint64
+
+	log     *logrus.Logger
+	storage Storage
+	config  Config
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+func NewJanitor(log *logrus.Logger, s Storage, cfg Config) *Janitor {
+	return &Janitor{
+		log:     log,
+		storage: s,
+		config:  cfg,
+		quit:    make(chan struct{}),
+	}
+}
+
+//Start runs sweeps in background, first sweep starts immediately
+func (j *Janitor) Start() {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+
+		ticker := time.NewTicker(j.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			j.Sweep(time.Now())
+
+			select {
+			case <-j.quit:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	j.log.Infof("Janitor started with interval %v", j.config.Interval)
+}
+
+//Stop interrupts current sweep after its running batch and waits for background goroutine to finish
+func (j *Janitor) Stop() {
+	j.once.Do(func() {
+		close(j.quit)
+	})
+	j.wg.Wait()
+	j.log.Info("Janitor stopped")
+}
+
+//Sweep deletes clicks and hourly counters of expired links, expired links, clicks older than retention period
+//old idempotency keys and visitor salts. Hourly counters outlive retention period
+func (j *Janitor) Sweep(now time.Time) {
+	j.log.Debug("Janitor sweep started")
+	ctx := context.Background()
+
+	clicks := j.purge("clicks of expired links", func() (int64, error) {
+		return j.storage.DeleteExpiredClicks(ctx, now, j.config.BatchSize)
+	})
+
+	j.purge("click counters of expired links", func() (int64, error) {
+		return j.storage.DeleteExpiredRollups(ctx, now, j.config.BatchSize)
+	})
+
+	urls := j.purge("expired links", func() (int64, error) {
+		return j.storage.DeleteExpiredUrls(ctx, now, j.config.BatchSize)
+	})
+
+	if j.config.ClickRetention > 0 {
+		before := now.Add(-j.config.ClickRetention)
+		clicks += j.purge("old clicks", func() (int64, error) {
+			return j.storage.DeleteClicksBefore(ctx, before, j.config.BatchSize)
+		})
+	}
+
+	if j.config.IdempotencyKeyTTL > 0 {
+		before := now.Add(-j.config.IdempotencyKeyTTL)
+		keys := j.purge("old idempotency keys", func() (int64, error) {
+			return j.storage.DeleteIdempotencyKeysBefore(ctx, before, j.config.BatchSize)
+		})
+		j.log.Debugf("Janitor deleted %d idempotency keys", keys)
+	}
+
+	j.purge("old visitor salts", func() (int64, error) {
+		return j.storage.DeleteVisitorSaltsBefore(ctx, now.Add(-visitorSaltTTL), j.config.BatchSize)
+	})
+
+	atomic.AddUint64(&j.sweeps, 1)
+	atomic.AddUint64(&j.deletedUrls, uint64(urls))
+	atomic.AddUint64(&j.deletedClicks, uint64(clicks))
+	j.log.Infof("Janitor sweep finished, deleted %d links and %d clicks", urls, clicks)
+}
+
+//Stats are janitor counters since start
+type Stats struct {
+	Sweeps        uint64
+	DeletedUrls   uint64
+	DeletedClicks uint64
+}
+
+func (j *Janitor) Stats() Stats {
+	return Stats{
+		Sweeps:        atomic.LoadUint64(&j.sweeps),
+		DeletedUrls:   atomic.LoadUint64(&j.deletedUrls),
+		DeletedClicks: atomic.LoadUint64(&j.deletedClicks),
+	}
+}
+
+//purge calls deleteBatch until it deletes less than a batch or janitor is stopped
+func (j *Janitor) purge(what string, deleteBatch func() (int64, error)) int64 {
+	var total int64
+	for {
+		deleted, err := deleteBatch()
+		if err != nil {
+			j.log.Errorf("Janitor can't delete %s, got %v", what, err)
+			return total
+		}
+		total += deleted
+
+		if deleted < int64(j.config.BatchSize) {
+			return total
+		}
+
+		select {
+		case <-j.quit:
+			j.log.Infof("Janitor interrupted while deleting %s", what)
+			return total
+		case <-time.After(batchPause):
+		}
+	}
+}
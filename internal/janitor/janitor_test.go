@@ -0,0 +1,89 @@
+package janitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockStorage struct {
+	expiredClicks  int64
+	expiredRollups int64
+	expiredUrls    int64
+	oldClicks      int64
+	oldKeys        int64
+	oldSalts       int64
+	calls          int
+}
+
+func (m *mockStorage) DeleteExpiredClicks(ctx context.Context, now time.Time, batchSize int) (int64, error) {
+	return m.take(&m.expiredClicks, batchSize), nil
+}
+
+func (m *mockStorage) DeleteExpiredRollups(ctx context.Context, now time.Time, batchSize int) (int64, error) {
+	return m.take(&m.expiredRollups, batchSize), nil
+}
+
+func (m *mockStorage) DeleteExpiredUrls(ctx context.Context, now time.Time, batchSize int) (int64, error) {
+	return m.take(&m.expiredUrls, batchSize), nil
+}
+
+func (m *mockStorage) DeleteClicksBefore(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	return m.take(&m.oldClicks, batchSize), nil
+}
+
+func (m *mockStorage) DeleteIdempotencyKeysBefore(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	return m.take(&m.oldKeys, batchSize), nil
+}
+
+func (m *mockStorage) DeleteVisitorSaltsBefore(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	return m.take(&m.oldSalts, batchSize), nil
+}
+
+func (m *mockStorage) take(rows *int64, batchSize int) int64 {
+	m.calls++
+	deleted := *rows
+	if deleted > int64(batchSize) {
+		deleted = int64(batchSize)
+	}
+	*rows -= deleted
+	return deleted
+}
+
+func TestSweep(t *testing.T) {
+	s := &mockStorage{expiredClicks: 25, expiredRollups: 12, expiredUrls: 3, oldClicks: 10, oldKeys: 5, oldSalts: 2}
+	j := NewJanitor(logrus.New(), s, Config{Interval: time.Hour, ClickRetention: time.Hour, IdempotencyKeyTTL: time.Hour, BatchSize: 10})
+
+	j.Sweep(time.Now())
+
+	assert.Equal(t, int64(0), s.expiredClicks)
+	assert.Equal(t, int64(0), s.expiredRollups)
+	assert.Equal(t, int64(0), s.expiredUrls)
+	assert.Equal(t, int64(0), s.oldClicks)
+	assert.Equal(t, int64(0), s.oldKeys)
+	assert.Equal(t, int64(0), s.oldSalts)
+	assert.Equal(t, 3+2+1+2+1+1, s.calls)
+}
+
+func TestSweepWithoutClickRetention(t *testing.T) {
+	s := &mockStorage{oldClicks: 10, oldKeys: 5}
+	j := NewJanitor(logrus.New(), s, Config{Interval: time.Hour, BatchSize: 10})
+
+	j.Sweep(time.Now())
+
+	assert.Equal(t, int64(10), s.oldClicks)
+	assert.Equal(t, int64(5), s.oldKeys)
+}
+
+func TestStop(t *testing.T) {
+	s := &mockStorage{expiredClicks: 1000}
+	j := NewJanitor(logrus.New(), s, Config{Interval: time.Hour, BatchSize: 1})
+
+	j.Start()
+	j.Stop()
+
+	assert.Greater(t, s.expiredClicks, int64(0))
+}
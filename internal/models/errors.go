@@ -0,0 +1,38 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+//Error kinds, every error returned by storage and repository to a client
+//wraps one of them or is considered internal
+var (
+	ErrInvalidInput    = errors.New("invalid input")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrExpired         = errors.New("expired")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrInternal        = errors.New("internal error")
+)
+
+var (
+	ErrInvalidUrl         = fmt.Errorf("%w: invalid url", ErrInvalidInput)
+	ErrInvalidAlias       = fmt.Errorf("%w: invalid alias", ErrInvalidInput)
+	ErrInvalidExpiration  = fmt.Errorf("%w: invalid expiration", ErrInvalidInput)
+	ErrAliasTaken         = fmt.Errorf("%w: alias is already taken", ErrConflict)
+	ErrIdempotencyReused  = fmt.Errorf("%w: idempotency key is already used for another request", ErrConflict)
+	ErrIdempotencyBusy    = fmt.Errorf("%w: request with the same idempotency key is in progress", ErrConflict)
+	ErrLinkNotFound       = fmt.Errorf("%w: short url doesn't exist", ErrNotFound)
+	ErrStatNotFound       = fmt.Errorf("%w: stat url doesn't exist", ErrNotFound)
+	ErrLinkExpired        = fmt.Errorf("%w: short url is expired", ErrExpired)
+	ErrApiKeyNotFound     = fmt.Errorf("%w: api key doesn't exist", ErrNotFound)
+	ErrInvalidApiKey      = fmt.Errorf("%w: invalid or revoked api key", ErrUnauthorized)
+	ErrApiKeyRequired     = fmt.Errorf("%w: api key is required", ErrUnauthorized)
+	ErrLinkCredentials    = fmt.Errorf("%w: statId or owner's api key is required", ErrUnauthorized)
+	ErrLinkAccessDenied   = fmt.Errorf("%w: link can be managed by its owner or with its statId only", ErrForbidden)
+	ErrDestinationBlocked = fmt.Errorf("%w: destination is blocked", ErrForbidden)
+	ErrRateLimited        = fmt.Errorf("%w: rate limit exceeded", ErrTooManyRequests)
+)
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type ShortLinkScheme struct {
 	FullUrl        string
 	ShortId        string
@@ -7,17 +9,186 @@ type ShortLinkScheme struct {
 	ExpirationDate string
 }
 
+//GenerateResult is a result of creating one link of a batch, Err is set if the link isn't created
+type GenerateResult struct {
+	Data *ShortLinkScheme
+	Err  error
+}
+
+//BulkRowScheme is a result row of bulk creation, Row is a number of row in request starting from 1
+type BulkRowScheme struct {
+	Row int
+	*ShortLinkScheme
+	Error *ErrorScheme `json:",omitempty"`
+}
+
+//StatsScheme holds link's clicks count split into clicks of people and bots, estimated number of unique visitors, the latest clicks and
+//the most frequent referrer hosts, browsers, operating systems, device classes, languages and countries.
+//Visitors are told apart by hash of ip and user agent salted with a daily rotated salt,
+//so the same visitor coming on different days is counted once a day, bots aren't visitors.
+//ClickCount, latest clicks, breakdowns and series include bots unless they're excluded by StatsFilter.
+//Empty value in breakdowns means it's unknown or, for referrers, direct visit.
+//Series is filled if stats are requested by intervals
 type StatsScheme struct {
-	ClickCount     int64
-	ExpirationDate string
-	Clicks         []*ClickScheme
+	ClickCount       int64
+	HumanClicks      int64
+	BotClicks        int64
+	UniqueVisitors   int64
+	ExpirationDate   string
+	Clicks           []*ClickScheme
+	Referrers        []*CountScheme
+	Browsers         []*CountScheme
+	OperatingSystems []*CountScheme
+	Devices          []*CountScheme
+	Languages        []*CountScheme
+	Countries        []*CountScheme
+
+	Interval string               `json:",omitempty"`
+	Timezone string               `json:",omitempty"`
+	Series   []*SeriesPointScheme `json:",omitempty"`
+}
+
+//StatsFilter selects clicks counted in stats
+type StatsFilter struct {
+	ExcludeBots bool
+}
+
+//SeriesQuery requests clicks between From and To grouped by Interval in Location
+type SeriesQuery struct {
+	From     time.Time
+	To       time.Time
+	Interval string
+	Location *time.Location
+}
+
+//SeriesPointScheme is number of clicks and unique visitors of interval starting at Start (RFC3339)
+type SeriesPointScheme struct {
+	Start    string
+	Clicks   int64
+	Visitors int64
+}
+
+//ClickRollup is number of clicks of an hour, how many of them are bots' ones and HyperLogLog sketch of its visitors
+type ClickRollup struct {
+	Hour      time.Time
+	Clicks    int64
+	BotClicks int64
+	Visitors  []byte
 }
 
+//CountScheme is number of clicks with the same Value
+type CountScheme struct {
+	Value string
+	Count int64
+}
+
+//FullUrlScheme is a request for a short link.
+//Expiration is set by one of TTL (seconds), ExpirationDate (RFC3339 or 2006-01-02) or NeverExpires,
+//server's default TTL is used if none of them is set
+//Dedupe returns existing active link of the same owner to the same normalized url instead of creating new one.
+//OwnerKeyId, NormalizedUrl, IdempotencyKey and RequestHash are set by server only
 type FullUrlScheme struct {
-	Url string
+	Url            string
+	Alias          string
+	TTL            int64
+	ExpirationDate string
+	NeverExpires   bool
+	Dedupe         bool
+	OwnerKeyId     int64  `json:"-"`
+	NormalizedUrl  string `json:"-"`
+	IdempotencyKey string `json:"-"`
+	RequestHash    string `json:"-"`
 }
 
 type ClickScheme struct {
 	IP   string
 	Time string
+	ClickDetails
+}
+
+//GeoLocation is where click came from, Country is ISO 3166-1 alpha-2 code, Region and City are English names
+type GeoLocation struct {
+	Country string
+	Region  string
+	City    string
+}
+
+//ClickDetails describes click's client.
+//Language is the preferred one of Accept-Language, Browser, OS, Device and Bot are recognized from UserAgent,
+//location is found by IP
+type ClickDetails struct {
+	Referrer     string
+	ReferrerHost string
+	UserAgent    string
+	Language     string
+	Browser      string
+	OS           string
+	Device       string
+	Bot          bool
+	GeoLocation
+}
+
+//ClickEvent is a redirect to be registered in stats.
+//Handler sets Referrer, UserAgent and Language to request's headers, others are filled when click is registered.
+//VisitorHash is salted hash of ip and user agent, it's counted in unique visitors but never stored
+type ClickEvent struct {
+	ShortId     string
+	IP          string
+	Time        time.Time
+	VisitorHash uint64
+	ClickDetails
+}
+
+//ApiKeyScheme describes api key, Key itself is known only when it's created
+type ApiKeyScheme struct {
+	Id        int64
+	Name      string
+	Key       string `json:",omitempty"`
+	CreatedAt string
+	RevokedAt string `json:",omitempty"`
+}
+
+//LinkScheme describes short link in management api, expiration date is empty for never expiring links
+type LinkScheme struct {
+	Id             int64  `json:"-"`
+	StatId         string `json:"-"`
+	ShortId        string
+	FullUrl        string
+	ExpirationDate string
+	CreatedAt      string
+	OwnerKeyId     int64 `json:",omitempty"`
+}
+
+//LinkUpdateScheme is a change of short link, empty fields are left as is.
+//Expiration is changed by one of TTL (seconds), ExpirationDate (RFC3339 or 2006-01-02) or NeverExpires.
+//NormalizedUrl is set by server only
+type LinkUpdateScheme struct {
+	Url            string
+	TTL            int64
+	ExpirationDate string
+	NeverExpires   bool
+	NormalizedUrl  string `json:"-"`
+}
+
+//LinkFilter selects links for list, zero fields don't filter.
+//Links are listed from the newest, AfterId is id of the last link of previous page
+type LinkFilter struct {
+	OwnerKeyId  int64
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Host        string
+	AfterId     int64
+	Limit       int
+}
+
+//LinkListScheme is a page of links, Cursor is empty on the last page
+type LinkListScheme struct {
+	Links  []*LinkScheme
+	Cursor string `json:",omitempty"`
+}
+
+//ErrorScheme is a body of error response
+type ErrorScheme struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+//Reload reads blocklist file if it's changed since last load, returns true if blocklist is replaced.
+//Broken file leaves previous blocklist in place
+func (p *Policy) Reload() (bool, error) {
+	info, err := os.Stat(p.config.BlocklistFile)
+	if err != nil {
+		return false, fmt.Errorf("can't read blocklist: %w", err)
+	}
+
+	p.mu.RLock()
+	unchanged := info.ModTime().Equal(p.modTime)
+	p.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	hosts, err := readBlocklist(p.config.BlocklistFile)
+	if err != nil {
+		return false, fmt.Errorf("can't read blocklist: %w", err)
+	}
+
+	p.mu.Lock()
+	p.blocklist = newHostSet(hosts)
+	p.modTime = info.ModTime()
+	p.mu.Unlock()
+
+	p.log.Infof("Blocklist %s loaded, %d hosts", p.config.BlocklistFile, len(hosts))
+
+	return true, nil
+}
+
+//Start watches blocklist file and reloads it when it's changed
+func (p *Policy) Start() {
+	if p.config.BlocklistFile == "" || p.config.ReloadInterval <= 0 {
+		return
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(p.config.ReloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.quit:
+				return
+			case <-ticker.C:
+				_, err := p.Reload()
+				if err != nil {
+					p.log.Error(err)
+				}
+			}
+		}
+	}()
+}
+
+//Stop stops watching blocklist file
+func (p *Policy) Stop() {
+	p.once.Do(func() {
+		close(p.quit)
+	})
+	p.wg.Wait()
+}
+
+//readBlocklist reads one host pattern per line, empty lines and lines starting with '#' are skipped
+func readBlocklist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var hosts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, line)
+	}
+
+	return hosts, scanner.Err()
+}
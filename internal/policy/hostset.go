@@ -0,0 +1,54 @@
+package policy
+
+import "strings"
+
+//hostSet matches hosts against exact names and "*.suffix" wildcards
+type hostSet struct {
+	exact    map[string]bool
+	suffixes map[string]bool
+}
+
+func newHostSet(patterns []string) *hostSet {
+	s := &hostSet{
+		exact:    make(map[string]bool),
+		suffixes: make(map[string]bool),
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+		switch {
+		case pattern == "":
+		case strings.HasPrefix(pattern, "*."):
+			s.suffixes[pattern[1:]] = true
+		default:
+			s.exact[pattern] = true
+		}
+	}
+
+	return s
+}
+
+func (s *hostSet) empty() bool {
+	return len(s.exact) == 0 && len(s.suffixes) == 0
+}
+
+//match checks host and its parent domains, "a.b.example.com" matches "*.example.com" and "*.b.example.com"
+func (s *hostSet) match(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if s.exact[host] {
+		return true
+	}
+
+	for i := strings.Index(host, "."); i >= 0; {
+		if s.suffixes[host[i:]] {
+			return true
+		}
+		next := strings.Index(host[i+1:], ".")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+
+	return false
+}
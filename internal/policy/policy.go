@@ -0,0 +1,240 @@
+//Package policy decides which destinations may be shortened
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"urlshortener/internal/models"
+)
+
+//Resolver looks up addresses of host, *net.Resolver implements it
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+//Config holds destination policy.
+//Allow and Deny hold hosts, "example.com" matches the host itself and "*.example.com" matches its subdomains.
+//Non empty Allow permits listed hosts only, Deny and BlocklistFile entries are refused.
+//BlockPrivateIPs refuses hosts resolving to private, loopback, link-local and other non public addresses
+type Config struct {
+	Allow           []string
+	Deny            []string
+	BlocklistFile   string
+	ReloadInterval  time.Duration
+	BlockPrivateIPs bool
+	ResolveTimeout  time.Duration
+}
+
+const defaultResolveTimeout = 2 * time.Second
+
+//resolvedTTL is how long host resolution is reused, so batches don't resolve the same host again
+const resolvedTTL = time.Minute
+const maxResolved = 10000
+
+//Policy checks destinations against configured lists and resolved addresses
+type Policy struct {
+	//counters go first to be 64-bit aligned for atomic operations
+	checked uint64
+	blocked uint64
+
+	log      *logrus.Logger
+	config   Config
+	resolver Resolver
+	allow    *hostSet
+	deny     *hostSet
+
+	mu        sync.RWMutex
+	blocklist *hostSet
+	modTime   time.Time
+
+	resolvedMu sync.Mutex
+	resolved   map[string]resolution
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+type resolution struct {
+	reason  string
+	expires time.Time
+}
+
+//NewPolicy creates policy and loads blocklist file, nil resolver means net.DefaultResolver
+func NewPolicy(log *logrus.Logger, cfg Config, resolver Resolver) (*Policy, error) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if cfg.ResolveTimeout == 0 {
+		cfg.ResolveTimeout = defaultResolveTimeout
+	}
+
+	p := &Policy{
+		log:       log,
+		config:    cfg,
+		resolver:  resolver,
+		allow:     newHostSet(cfg.Allow),
+		deny:      newHostSet(cfg.Deny),
+		blocklist: newHostSet(nil),
+		resolved:  make(map[string]resolution),
+		quit:      make(chan struct{}),
+	}
+
+	if cfg.BlocklistFile != "" {
+		_, err := p.Reload()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+//Stats are policy counters since start
+type Stats struct {
+	Checked uint64
+	Blocked uint64
+}
+
+func (p *Policy) Stats() Stats {
+	return Stats{
+		Checked: atomic.LoadUint64(&p.checked),
+		Blocked: atomic.LoadUint64(&p.blocked),
+	}
+}
+
+//Check returns error wrapping models.ErrDestinationBlocked if url may not be shortened,
+//refused attempts are written to audit log
+func (p *Policy) Check(url string, ownerKeyId int64) error {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return fmt.Errorf("%w: %v", models.ErrInvalidUrl, err)
+	}
+	host := strings.ToLower(u.Hostname())
+
+	atomic.AddUint64(&p.checked, 1)
+	reason := p.reason(host)
+	if reason == "" {
+		return nil
+	}
+	atomic.AddUint64(&p.blocked, 1)
+
+	p.log.WithFields(logrus.Fields{
+		"audit":      "destination_blocked",
+		"url":        url,
+		"host":       host,
+		"ownerKeyId": ownerKeyId,
+		"reason":     reason,
+	}).Warn("destination blocked")
+
+	return fmt.Errorf("%w: %s", models.ErrDestinationBlocked, reason)
+}
+
+//reason returns why host is refused, empty string if it's permitted
+func (p *Policy) reason(host string) string {
+	if !p.allow.empty() && !p.allow.match(host) {
+		return fmt.Sprintf("host '%s' is not in allow list", host)
+	}
+	if p.deny.match(host) {
+		return fmt.Sprintf("host '%s' is denied", host)
+	}
+
+	p.mu.RLock()
+	blocked := p.blocklist.match(host)
+	p.mu.RUnlock()
+	if blocked {
+		return fmt.Sprintf("host '%s' is in blocklist", host)
+	}
+
+	if p.config.BlockPrivateIPs {
+		return p.addressReason(host)
+	}
+
+	return ""
+}
+
+//addressReason resolves host and refuses it if any of its addresses isn't public.
+//Host which can't be resolved is refused too
+func (p *Policy) addressReason(host string) string {
+	if ip := net.ParseIP(host); ip != nil {
+		return ipReason(host, ip)
+	}
+
+	now := time.Now()
+	p.resolvedMu.Lock()
+	r, ok := p.resolved[host]
+	p.resolvedMu.Unlock()
+	if ok && now.Before(r.expires) {
+		return r.reason
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.ResolveTimeout)
+	defer cancel()
+
+	reason := ""
+	addrs, err := p.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		reason = fmt.Sprintf("host '%s' can't be resolved", host)
+	} else if len(addrs) == 0 {
+		reason = fmt.Sprintf("host '%s' has no addresses", host)
+	}
+	for _, addr := range addrs {
+		reason = ipReason(host, addr.IP)
+		if reason != "" {
+			break
+		}
+	}
+
+	p.resolvedMu.Lock()
+	if len(p.resolved) >= maxResolved {
+		p.resolved = make(map[string]resolution)
+	}
+	p.resolved[host] = resolution{reason: reason, expires: now.Add(resolvedTTL)}
+	p.resolvedMu.Unlock()
+
+	return reason
+}
+
+//privateNets are ranges not covered by net.IP methods
+var privateNets = []*net.IPNet{
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+	mustParseCIDR("240.0.0.0/4"),
+	mustParseCIDR("64:ff9b::/96"),
+}
+
+func ipReason(host string, ip net.IP) string {
+	public := !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() && !ip.Equal(net.IPv4bcast)
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			public = false
+		}
+	}
+
+	if public {
+		return ""
+	}
+	if host == ip.String() {
+		return fmt.Sprintf("address %s is not public", ip)
+	}
+	return fmt.Sprintf("host '%s' resolves to not public address %s", host, ip)
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
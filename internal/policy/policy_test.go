@@ -0,0 +1,170 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/models"
+)
+
+type mockResolver struct {
+	hosts   map[string][]string
+	lookups int
+}
+
+func (m *mockResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	m.lookups++
+	ips, ok := m.hosts[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func newTestPolicy(t *testing.T, cfg Config, resolver Resolver) *Policy {
+	log := logrus.New()
+	log.SetLevel(logrus.FatalLevel)
+
+	p, err := NewPolicy(log, cfg, resolver)
+	assert.NoError(t, err)
+	return p
+}
+
+func TestHostSet(t *testing.T) {
+	s := newHostSet([]string{"Example.com", "*.evil.org", " ", "*.deep.test.net."})
+
+	assert.True(t, s.match("example.com"))
+	assert.False(t, s.match("www.example.com"))
+	assert.True(t, s.match("a.evil.org"))
+	assert.True(t, s.match("a.b.evil.org"))
+	assert.False(t, s.match("evil.org"))
+	assert.False(t, s.match("notevil.org"))
+	assert.True(t, s.match("x.deep.test.net"))
+	assert.False(t, s.match("test.net"))
+	assert.False(t, newHostSet(nil).match("example.com"))
+}
+
+func TestCheckLists(t *testing.T) {
+	p := newTestPolicy(t, Config{
+		Allow: []string{"yandex.ru", "*.yandex.ru", "evil.yandex.ru"},
+		Deny:  []string{"evil.yandex.ru"},
+	}, nil)
+
+	assert.NoError(t, p.Check("http://yandex.ru/", 0))
+	assert.NoError(t, p.Check("https://mail.yandex.ru/path", 0))
+
+	err := p.Check("http://google.com/", 0)
+	assert.ErrorIs(t, err, models.ErrDestinationBlocked)
+	assert.ErrorIs(t, err, models.ErrForbidden)
+	assert.Contains(t, err.Error(), "not in allow list")
+
+	err = p.Check("http://evil.yandex.ru/", 0)
+	assert.ErrorIs(t, err, models.ErrDestinationBlocked)
+	assert.Contains(t, err.Error(), "denied")
+}
+
+func TestCheckPrivateIPs(t *testing.T) {
+	resolver := &mockResolver{hosts: map[string][]string{
+		"public.test":   {"93.158.134.3"},
+		"internal.test": {"93.158.134.3", "10.1.2.3"},
+		"local.test":    {"127.0.0.1"},
+		"meta.test":     {"169.254.169.254"},
+		"v6.test":       {"fd00::1"},
+		"empty.test":    {},
+	}}
+	p := newTestPolicy(t, Config{BlockPrivateIPs: true}, resolver)
+
+	assert.NoError(t, p.Check("http://public.test/", 0))
+	assert.NoError(t, p.Check("http://93.158.134.3/", 0))
+	assert.NoError(t, p.Check("http://[2a02:6b8::2:242]/", 0))
+
+	blocked := []string{
+		"http://internal.test/",
+		"http://local.test/",
+		"http://meta.test/latest/meta-data",
+		"http://v6.test/",
+		"http://empty.test/",
+		"http://unknown.test/",
+		"http://127.0.0.1:8080/",
+		"http://192.168.0.1/",
+		"http://[::1]/",
+		"http://[fe80::1]/",
+		"http://0.0.0.0/",
+		"http://100.64.0.1/",
+	}
+	for _, url := range blocked {
+		assert.ErrorIs(t, p.Check(url, 0), models.ErrDestinationBlocked, url)
+	}
+
+	lookups := resolver.lookups
+	assert.NoError(t, p.Check("http://public.test/other", 0))
+	assert.Equal(t, lookups, resolver.lookups)
+
+	p = newTestPolicy(t, Config{}, resolver)
+	assert.NoError(t, p.Check("http://local.test/", 0))
+	assert.NoError(t, p.Check("http://127.0.0.1/", 0))
+}
+
+func TestCheckAuditLog(t *testing.T) {
+	log, hook := test.NewNullLogger()
+	p, err := NewPolicy(log, Config{Deny: []string{"evil.org"}}, nil)
+	assert.NoError(t, err)
+
+	assert.Error(t, p.Check("http://evil.org/phish", 7))
+	entry := hook.LastEntry()
+	assert.NotNil(t, entry)
+	assert.Equal(t, logrus.WarnLevel, entry.Level)
+	assert.Equal(t, "destination_blocked", entry.Data["audit"])
+	assert.Equal(t, "evil.org", entry.Data["host"])
+	assert.Equal(t, int64(7), entry.Data["ownerKeyId"])
+
+	hook.Reset()
+	assert.NoError(t, p.Check("http://good.org/", 7))
+	assert.Nil(t, hook.LastEntry())
+}
+
+func TestBlocklistReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# phishing\nevil.org\n\n*.bad.net\n"), 0644))
+
+	p := newTestPolicy(t, Config{BlocklistFile: path, ReloadInterval: 10 * time.Millisecond}, nil)
+	assert.ErrorIs(t, p.Check("http://evil.org/", 0), models.ErrDestinationBlocked)
+	assert.ErrorIs(t, p.Check("http://a.bad.net/", 0), models.ErrDestinationBlocked)
+	assert.NoError(t, p.Check("http://new.org/", 0))
+
+	p.Start()
+	defer p.Stop()
+
+	assert.NoError(t, os.WriteFile(path, []byte("new.org\n"), 0644))
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, later, later))
+
+	assert.Eventually(t, func() bool {
+		return p.Check("http://new.org/", 0) != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, p.Check("http://evil.org/", 0))
+
+	assert.NoError(t, os.Remove(path))
+	_, err := p.Reload()
+	assert.Error(t, err)
+	assert.Error(t, p.Check("http://new.org/", 0))
+}
+
+func TestNewPolicyMissingBlocklist(t *testing.T) {
+	_, err := NewPolicy(logrus.New(), Config{BlocklistFile: filepath.Join(t.TempDir(), "missing")}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+//Memory keeps buckets in process memory, limits aren't shared between instances
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket)}
+}
+
+func (m *Memory) Take(key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.burst(), last: now}
+		m.buckets[key] = b
+	}
+
+	var allowed bool
+	b.tokens, allowed = take(b.tokens, now.Sub(b.last), limit)
+	if now.After(b.last) {
+		b.last = now
+	}
+
+	r := result(b.tokens, allowed, limit)
+	b.full = now.Add(r.Reset)
+	return r, nil
+}
+
+//sweep drops buckets which are full again, they are the same as missing ones
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.swept) < sweepInterval {
+		return
+	}
+	m.swept = now
+
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+//Package ratelimit implements token bucket rate limits kept in memory or in redis
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+//Limit allows Requests per Period with bursts up to Burst requests, Burst defaults to Requests.
+//Limit with no requests is off
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+//Enabled reports if limit is on
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+func (l Limit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+//rate returns tokens added to bucket per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+//Result of taking token from bucket.
+//Reset is time until bucket is full again, RetryAfter is time until next token when request isn't allowed
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+//Store keeps buckets, Take takes one token from bucket with key
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+//take refills bucket holding tokens for elapsed time and takes one token from it,
+//returns tokens left and whether token is taken
+func take(tokens float64, elapsed time.Duration, limit Limit) (float64, bool) {
+	if elapsed > 0 {
+		tokens = math.Min(limit.burst(), tokens+elapsed.Seconds()*limit.rate())
+	}
+	if tokens < 1 {
+		return tokens, false
+	}
+	return tokens - 1, true
+}
+
+//result describes bucket with tokens left
+func result(tokens float64, allowed bool, limit Limit) Result {
+	r := Result{
+		Allowed:   allowed,
+		Limit:     int(limit.burst()),
+		Remaining: int(tokens),
+		Reset:     seconds((limit.burst() - tokens) / limit.rate()),
+	}
+	if !allowed {
+		r.RetryAfter = seconds((1 - tokens) / limit.rate())
+	}
+	return r
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
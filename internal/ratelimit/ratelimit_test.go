@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	limit := Limit{Requests: 2, Period: time.Second, Burst: 3}
+	now := time.Now()
+
+	for i := 2; i >= 0; i-- {
+		r, err := m.Take("a", limit, now)
+		assert.NoError(t, err)
+		assert.True(t, r.Allowed)
+		assert.Equal(t, 3, r.Limit)
+		assert.Equal(t, i, r.Remaining)
+	}
+
+	r, _ := m.Take("a", limit, now)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, 0, r.Remaining)
+	assert.Equal(t, 500*time.Millisecond, r.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, r.Reset)
+
+	r, _ = m.Take("b", limit, now)
+	assert.True(t, r.Allowed)
+
+	r, _ = m.Take("a", limit, now.Add(500*time.Millisecond))
+	assert.True(t, r.Allowed)
+	assert.Equal(t, 0, r.Remaining)
+
+	r, _ = m.Take("a", limit, now.Add(time.Hour))
+	assert.True(t, r.Allowed)
+	assert.Equal(t, 2, r.Remaining)
+}
+
+func TestMemorySweep(t *testing.T) {
+	m := NewMemory()
+	limit := Limit{Requests: 10, Period: time.Second}
+	now := time.Now()
+
+	m.Take("a", limit, now)
+	m.Take("b", limit, now)
+	assert.Len(t, m.buckets, 2)
+
+	m.Take("c", limit, now.Add(2*sweepInterval))
+	assert.Len(t, m.buckets, 1)
+}
+
+func TestLimitEnabled(t *testing.T) {
+	assert.False(t, Limit{}.Enabled())
+	assert.False(t, Limit{Requests: -1, Period: time.Minute}.Enabled())
+	assert.True(t, Limit{Requests: 1, Period: time.Minute}.Enabled())
+}
+
+//scriptDoer runs Go version of takeScript over its own hashes
+type scriptDoer struct {
+	tokens map[string]float64
+	ts     map[string]int64
+	err    error
+}
+
+func (d *scriptDoer) Do(args ...string) (interface{}, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if args[0] != "EVAL" || args[1] != takeScript || args[2] != "1" {
+		return nil, errors.New("unexpected command")
+	}
+
+	key := args[3]
+	rate, _ := strconv.ParseFloat(args[4], 64)
+	burst, _ := strconv.ParseFloat(args[5], 64)
+	now, _ := strconv.ParseInt(args[6], 10, 64)
+
+	tokens, ok := d.tokens[key]
+	ts := d.ts[key]
+	if !ok {
+		tokens, ts = burst, now
+	}
+	if now > ts {
+		tokens += float64(now-ts) * rate
+		if tokens > burst {
+			tokens = burst
+		}
+		ts = now
+	}
+	allowed := int64(0)
+	if tokens >= 1 {
+		tokens--
+		allowed = 1
+	}
+	d.tokens[key], d.ts[key] = tokens, ts
+
+	return []interface{}{allowed, strconv.FormatFloat(tokens, 'g', -1, 64)}, nil
+}
+
+func TestRedis(t *testing.T) {
+	d := &scriptDoer{tokens: make(map[string]float64), ts: make(map[string]int64)}
+	r := NewRedis(d, "rl:")
+	limit := Limit{Requests: 60, Period: time.Minute}
+	now := time.Now()
+
+	for i := 0; i < 60; i++ {
+		res, err := r.Take("a", limit, now)
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+	res, err := r.Take("a", limit, now)
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, time.Minute, res.Reset)
+	assert.Contains(t, d.tokens, "rl:a")
+
+	res, _ = r.Take("a", limit, now.Add(time.Second))
+	assert.True(t, res.Allowed)
+
+	d.err = errors.New("connection refused")
+	_, err = r.Take("a", limit, now)
+	assert.Error(t, err)
+}
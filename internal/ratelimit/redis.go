@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+//Doer sends command to server speaking redis protocol, *cache.Redis implements it
+type Doer interface {
+	Do(args ...string) (interface{}, error)
+}
+
+//Redis keeps buckets in redis so instances share limits.
+//Buckets are hashes of tokens and update time in ms refilled and taken by one script atomically
+type Redis struct {
+	client Doer
+	prefix string
+}
+
+func NewRedis(client Doer, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+//takeScript gets KEYS[1] bucket and ARGV rate per ms, burst, now in ms.
+//Bucket expires when it's full again, returns {allowed, tokens left}
+const takeScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+if now > ts then
+  tokens = math.min(burst, tokens + (now - ts) * rate)
+  ts = now
+end
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1)
+return {allowed, tostring(tokens)}
+`
+
+func (r *Redis) Take(key string, limit Limit, now time.Time) (Result, error) {
+	reply, err := r.client.Do("EVAL", takeScript, "1", r.prefix+key,
+		strconv.FormatFloat(limit.rate()/1000, 'g', -1, 64),
+		strconv.FormatFloat(limit.burst(), 'g', -1, 64),
+		strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10))
+	if err != nil {
+		return Result{}, fmt.Errorf("rate limit error: %w", err)
+	}
+
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != 2 {
+		return Result{}, fmt.Errorf("rate limit error: unexpected reply %v", reply)
+	}
+	allowed, ok := items[0].(int64)
+	if !ok {
+		return Result{}, fmt.Errorf("rate limit error: unexpected reply %v", reply)
+	}
+	tokensReply, _ := items[1].(string)
+	tokens, err := strconv.ParseFloat(tokensReply, 64)
+	if err != nil || math.IsNaN(tokens) {
+		return Result{}, fmt.Errorf("rate limit error: unexpected reply %v", reply)
+	}
+
+	return result(tokens, allowed == 1, limit), nil
+}
@@ -0,0 +1,134 @@
+//Package realip finds client's ip of requests coming through trusted proxies
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+//Resolver takes client's ip from Forwarded, X-Forwarded-For or X-Real-IP headers
+//when request comes from trusted proxy, headers of other peers are ignored
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+//NewResolver creates resolver trusting proxies in given CIDRs, single addresses are accepted too
+func NewResolver(trustedProxies []string) (*Resolver, error) {
+	r := &Resolver{}
+
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy '%s'", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			r.trusted = append(r.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s': %w", proxy, err)
+		}
+		r.trusted = append(r.trusted, n)
+	}
+
+	return r, nil
+}
+
+//ClientIP returns client's ip, nil if peer's address can't be parsed.
+//Forwarded chain is walked from the nearest hop, the first untrusted address is client's one.
+//Forwarded is preferred to X-Forwarded-For, X-Real-IP is used if neither is present
+func (r *Resolver) ClientIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !r.isTrusted(peer) {
+		return peer
+	}
+
+	var hops []string
+	if values := req.Header.Values("Forwarded"); len(values) > 0 {
+		hops = forwardedFor(values)
+	} else if values := req.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		hops = strings.Split(strings.Join(values, ","), ",")
+	} else if value := req.Header.Get("X-Real-IP"); value != "" {
+		hops = []string{value}
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseNode(hops[i])
+		if ip == nil {
+			//unknown or obfuscated hop, the chain before it can't be checked
+			break
+		}
+		client = ip
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+
+	return client
+}
+
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	for _, n := range r.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//forwardedFor returns "for" parameters of RFC 7239 Forwarded header's elements
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			node := ""
+			for _, pair := range strings.Split(element, ";") {
+				i := strings.Index(pair, "=")
+				if i < 0 {
+					continue
+				}
+				if strings.EqualFold(strings.TrimSpace(pair[:i]), "for") {
+					node = strings.TrimSpace(pair[i+1:])
+				}
+			}
+			hops = append(hops, node)
+		}
+	}
+	return hops
+}
+
+//parseNode parses ip of node which can be quoted and have port, like "[2001:db8::1]:4711" or 192.0.2.1:80
+func parseNode(node string) net.IP {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+
+	if strings.HasPrefix(node, "[") {
+		end := strings.Index(node, "]")
+		if end < 0 {
+			return nil
+		}
+		return net.ParseIP(node[1:end])
+	}
+
+	if ip := net.ParseIP(node); ip != nil {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(node)
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,62 @@
+package realip
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewResolver(t *testing.T) {
+	_, err := NewResolver([]string{"10.0.0.0/8", "192.168.1.1", "::1", "fd00::/8"})
+	assert.NoError(t, err)
+
+	_, err = NewResolver([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+	_, err = NewResolver([]string{"proxy.local"})
+	assert.Error(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	r, err := NewResolver([]string{"10.0.0.0/8", "192.168.1.1", "::1"})
+	assert.NoError(t, err)
+
+	cases := []struct {
+		remoteAddr string
+		headers    map[string][]string
+		ip         string
+	}{
+		{"203.0.113.7:1000", nil, "203.0.113.7"},
+		{"203.0.113.7:1000", map[string][]string{"X-Forwarded-For": {"1.1.1.1"}}, "203.0.113.7"},
+		{"10.0.0.1:1000", nil, "10.0.0.1"},
+		{"10.0.0.1:1000", map[string][]string{"X-Forwarded-For": {"1.1.1.1"}}, "1.1.1.1"},
+		{"10.0.0.1:1000", map[string][]string{"X-Forwarded-For": {"6.6.6.6, 1.1.1.1, 10.0.0.2"}}, "1.1.1.1"},
+		{"10.0.0.1:1000", map[string][]string{"X-Forwarded-For": {"6.6.6.6, 1.1.1.1", "192.168.1.1"}}, "1.1.1.1"},
+		{"10.0.0.1:1000", map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"10.0.0.1:1000", map[string][]string{"X-Forwarded-For": {"1.1.1.1, garbage"}}, "10.0.0.1"},
+		{"10.0.0.1:1000", map[string][]string{"X-Real-IP": {"2.2.2.2"}}, "2.2.2.2"},
+		{"10.0.0.1:1000", map[string][]string{"X-Real-IP": {"2.2.2.2"}, "X-Forwarded-For": {"1.1.1.1"}}, "1.1.1.1"},
+		{"10.0.0.1:1000", map[string][]string{"Forwarded": {`for=3.3.3.3;proto=https, for="10.0.0.2:8080"`}, "X-Forwarded-For": {"1.1.1.1"}}, "3.3.3.3"},
+		{"10.0.0.1:1000", map[string][]string{"Forwarded": {`For="[2001:db8::1]:4711"`}}, "2001:db8::1"},
+		{"10.0.0.1:1000", map[string][]string{"Forwarded": {`for=unknown`}}, "10.0.0.1"},
+		{"10.0.0.1:1000", map[string][]string{"Forwarded": {`for=_hidden, for=4.4.4.4`}}, "4.4.4.4"},
+		{"10.0.0.1:1000", map[string][]string{"Forwarded": {`proto=https`}}, "10.0.0.1"},
+		{"[::1]:1000", map[string][]string{"X-Forwarded-For": {"2001:db8::2"}}, "2001:db8::2"},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remoteAddr
+		for name, values := range c.headers {
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+		}
+
+		assert.Equal(t, c.ip, r.ClientIP(req).String(), c.remoteAddr, c.headers)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "garbage"
+	assert.Nil(t, r.ClientIP(req))
+}
@@ -0,0 +1,42 @@
+package usrepo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"urlshortener/internal/models"
+)
+
+const minAliasLength = 3
+const maxAliasLength = 64
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+//reservedAliases holds first path segments served by the router itself
+var reservedAliases = map[string]bool{
+	"api":      true,
+	"generate": true,
+	"stat":     true,
+	"heart":    true,
+	"metrics":  true,
+	"healthz":  true,
+	"readyz":   true,
+}
+
+//validateAlias checks that alias can be used as short id
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return fmt.Errorf("%w: length must be between %d and %d", models.ErrInvalidAlias, minAliasLength, maxAliasLength)
+	}
+
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("%w: only latin letters, digits, '-' and '_' are allowed", models.ErrInvalidAlias)
+	}
+
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("%w: '%s' is reserved", models.ErrInvalidAlias, alias)
+	}
+
+	return nil
+}
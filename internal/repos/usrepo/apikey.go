@@ -0,0 +1,96 @@
+package usrepo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"urlshortener/internal/models"
+)
+
+const apiKeyPrefix = "us_"
+const apiKeyBytes = 32
+
+//CreateApiKey generates new api key, only its hash is stored so the key is returned once
+func (us *UrlShortener) CreateApiKey(ctx context.Context, name string) (key *models.ApiKeyScheme, err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.CreateApiKey")
+	defer func() { endSpan(span, err) }()
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("create api key error: %w: name can't be empty", models.ErrInvalidInput)
+	}
+
+	random := make([]byte, apiKeyBytes)
+	_, err = rand.Read(random)
+	if err != nil {
+		return nil, fmt.Errorf("create api key error: %w", err)
+	}
+	plainKey := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+
+	key, err = us.repo.CreateApiKey(ctx, name, HashApiKey(plainKey))
+	if err != nil {
+		return nil, fmt.Errorf("create api key error: %w", err)
+	}
+	key.Key = plainKey
+
+	return key, nil
+}
+
+//Authenticate returns active api key matching plain key
+func (us *UrlShortener) Authenticate(ctx context.Context, plainKey string) (key *models.ApiKeyScheme, err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.Authenticate")
+	defer func() { endSpan(span, err) }()
+
+	key, err = us.repo.GetApiKey(ctx, HashApiKey(plainKey))
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, models.ErrInvalidApiKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("authenticate error: %w", err)
+	}
+
+	if key.RevokedAt != "" {
+		return nil, models.ErrInvalidApiKey
+	}
+
+	return key, nil
+}
+
+//ListApiKeys returns all api keys without keys themselves
+func (us *UrlShortener) ListApiKeys(ctx context.Context) (keys []*models.ApiKeyScheme, err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.ListApiKeys")
+	defer func() { endSpan(span, err) }()
+
+	keys, err = us.repo.ListApiKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys error: %w", err)
+	}
+
+	return keys, nil
+}
+
+//RevokeApiKey makes api key unusable, links created with it keep their owner
+func (us *UrlShortener) RevokeApiKey(ctx context.Context, id int64) (err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.RevokeApiKey")
+	defer func() { endSpan(span, err) }()
+
+	err = us.repo.RevokeApiKey(ctx, id)
+	if err != nil {
+		return fmt.Errorf("revoke api key error: %w", err)
+	}
+
+	return nil
+}
+
+//HashApiKey returns hex encoded SHA-256 of api key.
+//Keys are long and random so fast hash is enough to keep them safe in storage
+func HashApiKey(plainKey string) string {
+	sum := sha256.Sum256([]byte(plainKey))
+	return hex.EncodeToString(sum[:])
+}
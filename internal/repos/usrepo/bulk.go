@@ -0,0 +1,60 @@
+package usrepo
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"urlshortener/internal/models"
+)
+
+//MaxBatchSize limits number of links created at once
+const MaxBatchSize = 10000
+
+//GenerateShortUrls creates batch of links in one transaction.
+//Results are in order of urls, failure of one link is reported in its result and doesn't affect others
+func (us *UrlShortener) GenerateShortUrls(ctx context.Context, urls []models.FullUrlScheme) (results []models.GenerateResult, err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.GenerateShortUrls")
+	defer func() { endSpan(span, err) }()
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("generate short urls error: %w: batch is empty", models.ErrInvalidInput)
+	}
+	if len(urls) > MaxBatchSize {
+		return nil, fmt.Errorf("generate short urls error: %w: batch can't be larger than %d links", models.ErrInvalidInput, MaxBatchSize)
+	}
+
+	results = make([]models.GenerateResult, len(urls))
+
+	//only valid links go to storage, positions keeps their places in results
+	valid := make([]models.FullUrlScheme, 0, len(urls))
+	positions := make([]int, 0, len(urls))
+	now := time.Now()
+	for i, url := range urls {
+		err := us.validate(&url, now)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		valid = append(valid, url)
+		positions = append(positions, i)
+	}
+
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	created, err := us.repo.GenerateShortUrls(ctx, valid)
+	if err != nil {
+		return nil, fmt.Errorf("generate short urls error: %w", err)
+	}
+	for i, result := range created {
+		results[positions[i]] = result
+		if result.Err == nil {
+			atomic.AddUint64(&us.created, 1)
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,86 @@
+package usrepo
+
+import (
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"urlshortener/internal/models"
+	"urlshortener/internal/useragent"
+)
+
+const maxReferrerLength = 2048
+const maxUserAgentLength = 512
+
+//enrichClick recognizes client of click from its raw headers,
+//click which handler found automated stays a bot's one whatever its user agent is
+func enrichClick(click *models.ClickEvent) {
+	click.Referrer = truncate(click.Referrer, maxReferrerLength)
+	click.ReferrerHost = ""
+	if u, err := neturl.Parse(click.Referrer); err == nil {
+		click.ReferrerHost = strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	}
+
+	click.UserAgent = truncate(click.UserAgent, maxUserAgentLength)
+	info := useragent.Parse(click.UserAgent)
+	click.Browser = info.Browser
+	click.OS = info.OS
+	click.Device = info.Device
+	click.Bot = click.Bot || info.Bot
+	if click.Bot {
+		click.Device = useragent.Bot
+	}
+
+	click.Language = preferredLanguage(click.Language)
+}
+
+//preferredLanguage returns primary subtag of Accept-Language's language with the highest weight, like "en"
+func preferredLanguage(header string) string {
+	type language struct {
+		tag    string
+		weight float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(params[0]))
+		if i := strings.Index(tag, "-"); i >= 0 {
+			tag = tag[:i]
+		}
+		if tag == "" || tag == "*" || len(tag) > 8 {
+			continue
+		}
+
+		weight := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					weight = q
+				}
+			}
+		}
+		if weight > 0 {
+			languages = append(languages, language{tag: tag, weight: weight})
+		}
+	}
+
+	if len(languages) == 0 {
+		return ""
+	}
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].weight > languages[j].weight
+	})
+	return languages[0].tag
+}
+
+//truncate cuts s to length bytes dropping invalid UTF-8 which databases refuse to store
+func truncate(s string, length int) string {
+	if len(s) > length {
+		s = s[:length]
+	}
+	return strings.ToValidUTF8(s, "")
+}
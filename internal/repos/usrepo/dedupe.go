@@ -0,0 +1,45 @@
+package usrepo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"urlshortener/internal/models"
+)
+
+const maxIdempotencyKeyLength = 255
+
+//prepareDedupe sets normalized url and request hash of idempotency key, url must be in canonical form already.
+//Dedupe and idempotency keys are allowed for owned links only, otherwise anybody could get statId of anonymous link
+func prepareDedupe(url *models.FullUrlScheme) error {
+	if len(url.IdempotencyKey) > maxIdempotencyKeyLength {
+		return fmt.Errorf("%w: idempotency key can't be longer than %d", models.ErrInvalidInput, maxIdempotencyKeyLength)
+	}
+
+	if url.OwnerKeyId == 0 {
+		url.Dedupe = false
+		url.IdempotencyKey = ""
+	}
+
+	url.NormalizedUrl = dedupeUrl(url.Url)
+
+	//hash is taken before expiration is resolved, so retries with the same TTL match
+	if url.IdempotencyKey != "" {
+		request := fmt.Sprintf("%s\n%s\n%d\n%s\n%t\n%t", url.NormalizedUrl, url.Alias, url.TTL, url.ExpirationDate, url.NeverExpires, url.Dedupe)
+		sum := sha256.Sum256([]byte(request))
+		url.RequestHash = hex.EncodeToString(sum[:])
+	}
+
+	return nil
+}
+
+//dedupeUrl returns canonical url without fragment, links differing in fragment only lead to the same page
+func dedupeUrl(url string) string {
+	if i := strings.Index(url, "#"); i >= 0 {
+		return url[:i]
+	}
+
+	return url
+}
@@ -0,0 +1,70 @@
+package usrepo
+
+import (
+	"fmt"
+	"time"
+
+	"urlshortener/internal/models"
+)
+
+//resolveExpiration converts requested TTL or expiration date into absolute RFC3339 expiration date in UTC
+//checking it against configured limits
+func (us *UrlShortener) resolveExpiration(url *models.FullUrlScheme, now time.Time) error {
+	if url.TTL < 0 {
+		return fmt.Errorf("%w: TTL can't be negative", models.ErrInvalidExpiration)
+	}
+	if url.TTL > 0 && url.ExpirationDate != "" {
+		return fmt.Errorf("%w: only one of TTL and ExpirationDate can be set", models.ErrInvalidExpiration)
+	}
+
+	if url.NeverExpires {
+		if url.TTL > 0 || url.ExpirationDate != "" {
+			return fmt.Errorf("%w: never expiring link can't have TTL or ExpirationDate", models.ErrInvalidExpiration)
+		}
+		if !us.config.AllowNeverExpires {
+			return fmt.Errorf("%w: never expiring links are not allowed", models.ErrInvalidExpiration)
+		}
+		return nil
+	}
+
+	var expirationDate time.Time
+	switch {
+	case url.TTL > 0:
+		expirationDate = now.Add(time.Duration(url.TTL) * time.Second)
+	case url.ExpirationDate != "":
+		var err error
+		expirationDate, err = parseExpirationDate(url.ExpirationDate)
+		if err != nil {
+			return fmt.Errorf("%w: %v", models.ErrInvalidExpiration, err)
+		}
+		if !expirationDate.After(now) {
+			return fmt.Errorf("%w: expiration date is in the past", models.ErrInvalidExpiration)
+		}
+	default:
+		expirationDate = now.Add(us.config.DefaultTTL)
+	}
+
+	if us.config.MaxTTL > 0 && expirationDate.Sub(now) > us.config.MaxTTL {
+		return fmt.Errorf("%w: link can't live longer than %v", models.ErrInvalidExpiration, us.config.MaxTTL)
+	}
+
+	url.TTL = 0
+	url.ExpirationDate = expirationDate.UTC().Format(time.RFC3339)
+
+	return nil
+}
+
+//parseExpirationDate parses expiration date in RFC3339 or 2006-01-02 format
+func parseExpirationDate(value string) (time.Time, error) {
+	expirationDate, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return expirationDate, nil
+	}
+
+	expirationDate, err = time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expiration date '%s' must be in RFC3339 or 2006-01-02 format", value)
+	}
+
+	return expirationDate, nil
+}
@@ -0,0 +1,168 @@
+package usrepo
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strconv"
+	"time"
+
+	"urlshortener/internal/models"
+)
+
+const defaultLinksPageSize = 50
+const maxLinksPageSize = 500
+
+//Credentials prove the right to manage a link: its statId or api key of its owner
+type Credentials struct {
+	StatId   string
+	ApiKeyId int64
+}
+
+//GetLink returns link if credentials allow to manage it
+func (us *UrlShortener) GetLink(ctx context.Context, shortId string, cred Credentials) (link *models.LinkScheme, err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.GetLink")
+	defer func() { endSpan(span, err) }()
+
+	link, err = us.authorizeLink(ctx, shortId, cred)
+	if err != nil {
+		return nil, fmt.Errorf("get link error: %w", err)
+	}
+
+	return link, nil
+}
+
+//UpdateLink changes destination or expiration of link, expiration is checked against configured limits
+func (us *UrlShortener) UpdateLink(ctx context.Context, shortId string, update models.LinkUpdateScheme, cred Credentials) (link *models.LinkScheme, err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.UpdateLink")
+	defer func() { endSpan(span, err) }()
+
+	changeExpiration := update.TTL != 0 || update.ExpirationDate != "" || update.NeverExpires
+	if update.Url == "" && !changeExpiration {
+		return nil, fmt.Errorf("update link error: %w: nothing to update", models.ErrInvalidInput)
+	}
+
+	if changeExpiration {
+		url := models.FullUrlScheme{
+			TTL:            update.TTL,
+			ExpirationDate: update.ExpirationDate,
+			NeverExpires:   update.NeverExpires,
+		}
+		err = us.resolveExpiration(&url, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("update link error: %w", err)
+		}
+		update.TTL = 0
+		update.ExpirationDate = url.ExpirationDate
+	}
+
+	if update.Url != "" {
+		update.Url, err = us.normalizer.Normalize(update.Url)
+		if err != nil {
+			return nil, fmt.Errorf("update link error: %w", err)
+		}
+		update.NormalizedUrl = dedupeUrl(update.Url)
+	}
+
+	_, err = us.authorizeLink(ctx, shortId, cred)
+	if err != nil {
+		return nil, fmt.Errorf("update link error: %w", err)
+	}
+
+	if update.Url != "" {
+		err = us.checkDestination(update.Url, cred.ApiKeyId)
+		if err != nil {
+			return nil, fmt.Errorf("update link error: %w", err)
+		}
+	}
+
+	link, err = us.repo.UpdateLink(ctx, shortId, update)
+	if err != nil {
+		return nil, fmt.Errorf("update link error: %w", err)
+	}
+
+	return link, nil
+}
+
+//DeleteLink deletes link with its stats
+func (us *UrlShortener) DeleteLink(ctx context.Context, shortId string, cred Credentials) (err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.DeleteLink")
+	defer func() { endSpan(span, err) }()
+
+	_, err = us.authorizeLink(ctx, shortId, cred)
+	if err != nil {
+		return fmt.Errorf("delete link error: %w", err)
+	}
+
+	err = us.repo.DeleteLink(ctx, shortId)
+	if err != nil {
+		return fmt.Errorf("delete link error: %w", err)
+	}
+
+	return nil
+}
+
+//ListLinks returns page of links owned by filter.OwnerKeyId, cursor of the next page is set if there are more links
+func (us *UrlShortener) ListLinks(ctx context.Context, filter models.LinkFilter, cursor string) (list *models.LinkListScheme, err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.ListLinks")
+	defer func() { endSpan(span, err) }()
+
+	if filter.OwnerKeyId == 0 {
+		return nil, fmt.Errorf("list links error: %w", models.ErrApiKeyRequired)
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = defaultLinksPageSize
+	}
+	if filter.Limit < 0 || filter.Limit > maxLinksPageSize {
+		return nil, fmt.Errorf("list links error: %w: limit must be between 1 and %d", models.ErrInvalidInput, maxLinksPageSize)
+	}
+
+	if cursor != "" {
+		filter.AfterId, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil || filter.AfterId <= 0 {
+			return nil, fmt.Errorf("list links error: %w: invalid cursor '%s'", models.ErrInvalidInput, cursor)
+		}
+	}
+
+	//one extra link shows if there is the next page
+	limit := filter.Limit
+	filter.Limit++
+
+	links, err := us.repo.ListLinks(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list links error: %w", err)
+	}
+
+	list = &models.LinkListScheme{Links: links}
+	if len(links) > limit {
+		list.Links = links[:limit]
+		list.Cursor = strconv.FormatInt(links[limit-1].Id, 10)
+	}
+	if list.Links == nil {
+		list.Links = []*models.LinkScheme{}
+	}
+
+	return list, nil
+}
+
+//authorizeLink returns link if credentials have its statId or owner's api key
+func (us *UrlShortener) authorizeLink(ctx context.Context, shortId string, cred Credentials) (*models.LinkScheme, error) {
+	if cred.StatId == "" && cred.ApiKeyId == 0 {
+		return nil, models.ErrLinkCredentials
+	}
+
+	link, err := us.repo.GetLink(ctx, shortId)
+	if err != nil {
+		return nil, err
+	}
+
+	if cred.ApiKeyId != 0 && cred.ApiKeyId == link.OwnerKeyId {
+		return link, nil
+	}
+	if cred.StatId != "" && subtle.ConstantTimeCompare([]byte(cred.StatId), []byte(link.StatId)) == 1 {
+		return link, nil
+	}
+
+	return nil, models.ErrLinkAccessDenied
+}
@@ -0,0 +1,141 @@
+package usrepo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"urlshortener/internal/models"
+)
+
+//Stats intervals
+const (
+	IntervalHour  = "hour"
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+//maxSeriesPoints limits number of intervals in one stats request
+const maxSeriesPoints = 1000
+
+//defaultSeriesSpans are ranges of series requested without From
+var defaultSeriesSpans = map[string]func(to time.Time) time.Time{
+	IntervalHour:  func(to time.Time) time.Time { return to.Add(-48 * time.Hour) },
+	IntervalDay:   func(to time.Time) time.Time { return to.AddDate(0, 0, -30) },
+	IntervalWeek:  func(to time.Time) time.Time { return to.AddDate(0, 0, -12*7) },
+	IntervalMonth: func(to time.Time) time.Time { return to.AddDate(-1, 0, 0) },
+}
+
+//GetStatsSeries returns totals of stats with clicks and estimated unique visitors by intervals, filter applies to clicks too.
+//Everything is counted from hourly counters, so raw clicks aren't scanned and latest clicks and breakdowns are left out.
+//Clicks are counted by hours, so zones with offsets which aren't whole hours get approximate intervals
+func (us *UrlShortener) GetStatsSeries(ctx context.Context, statId string, filter models.StatsFilter, q models.SeriesQuery) (ss *models.StatsScheme, err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.GetStatsSeries")
+	defer func() { endSpan(span, err) }()
+
+	starts, err := seriesStarts(&q, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("get stats error: %w", err)
+	}
+
+	ss, err = us.repo.GetStatsTotals(ctx, statId, filter)
+	if err != nil {
+		return nil, fmt.Errorf("get stats error: %w", err)
+	}
+
+	rollups, err := us.repo.GetClickRollups(ctx, statId, starts[0], q.To)
+	if err != nil {
+		return nil, fmt.Errorf("get stats error: %w", err)
+	}
+
+	ss.Interval = q.Interval
+	ss.Timezone = q.Location.String()
+	ss.Series = make([]*models.SeriesPointScheme, len(starts))
+	rollupsOf := make([][]*models.ClickRollup, len(starts))
+	index := make(map[int64]int, len(starts))
+	for i, start := range starts {
+		ss.Series[i] = &models.SeriesPointScheme{Start: start.Format(time.RFC3339)}
+		index[start.Unix()] = i
+	}
+
+	for _, rollup := range rollups {
+		i, ok := index[intervalStart(rollup.Hour.In(q.Location), q.Interval).Unix()]
+		if !ok {
+			continue
+		}
+		ss.Series[i].Clicks += rollup.Clicks
+		if filter.ExcludeBots {
+			ss.Series[i].Clicks -= rollup.BotClicks
+		}
+		rollupsOf[i] = append(rollupsOf[i], rollup)
+	}
+	for i := range ss.Series {
+		ss.Series[i].Visitors, err = countVisitors(rollupsOf[i])
+		if err != nil {
+			return nil, fmt.Errorf("get stats error: %w", err)
+		}
+	}
+
+	return ss, nil
+}
+
+//seriesStarts checks query, fills its defaults and returns starts of its intervals
+func seriesStarts(q *models.SeriesQuery, now time.Time) ([]time.Time, error) {
+	if q.Interval == "" {
+		q.Interval = IntervalDay
+	}
+	span, ok := defaultSeriesSpans[q.Interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: interval must be hour, day, week or month", models.ErrInvalidInput)
+	}
+	if q.Location == nil {
+		q.Location = time.UTC
+	}
+	if q.To.IsZero() {
+		q.To = now
+	}
+	if q.From.IsZero() {
+		q.From = span(q.To)
+	}
+	if !q.From.Before(q.To) {
+		return nil, fmt.Errorf("%w: from must be before to", models.ErrInvalidInput)
+	}
+
+	var starts []time.Time
+	for start := intervalStart(q.From.In(q.Location), q.Interval); start.Before(q.To); start = nextInterval(start, q.Interval) {
+		if len(starts) == maxSeriesPoints {
+			return nil, fmt.Errorf("%w: more than %d intervals requested, use longer interval", models.ErrInvalidInput, maxSeriesPoints)
+		}
+		starts = append(starts, start)
+	}
+
+	return starts, nil
+}
+
+//intervalStart returns start of interval containing t in t's location, weeks start on Monday
+func intervalStart(t time.Time, interval string) time.Time {
+	year, month, day := t.Date()
+	switch interval {
+	case IntervalHour:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+	case IntervalWeek:
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, t.Location())
+	case IntervalMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+//nextInterval returns start of interval following the one starting at start
+func nextInterval(start time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalHour:
+		return start.Add(time.Hour)
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
@@ -1,40 +1,156 @@
 package usrepo
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 	"urlshortener/internal/models"
+	"urlshortener/internal/urlnorm"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+//tracerName is instrumentation name of repository spans
+const tracerName = "urlshortener/internal/repos/usrepo"
+
 type UrlShortenerRepo interface {
-	GenerateShortUrl(url models.FullUrlScheme) (data *models.ShortLinkScheme, err error)
-	GetFullUrl(shortId string) (urlScheme *models.FullUrlScheme, err error)
-	RegisterClick(shortId string, ip string) (err error)
-	GetStats(statId string) (ss *models.StatsScheme, err error)
+	GenerateShortUrl(ctx context.Context, url models.FullUrlScheme) (data *models.ShortLinkScheme, err error)
+	GenerateShortUrls(ctx context.Context, urls []models.FullUrlScheme) (results []models.GenerateResult, err error)
+	GetFullUrl(ctx context.Context, shortId string) (urlScheme *models.FullUrlScheme, err error)
+	RegisterClicks(ctx context.Context, clicks []models.ClickEvent) (err error)
+	GetStats(ctx context.Context, statId string, filter models.StatsFilter) (ss *models.StatsScheme, err error)
+	GetClickRollups(ctx context.Context, statId string, from time.Time, to time.Time) (rollups []*models.ClickRollup, err error)
+	GetStatsTotals(ctx context.Context, statId string, filter models.StatsFilter) (ss *models.StatsScheme, err error)
+	VisitorSalt(ctx context.Context, day string, salt string) (saved string, err error)
+
+	GetLink(ctx context.Context, shortId string) (link *models.LinkScheme, err error)
+	UpdateLink(ctx context.Context, shortId string, update models.LinkUpdateScheme) (link *models.LinkScheme, err error)
+	DeleteLink(ctx context.Context, shortId string) (err error)
+	ListLinks(ctx context.Context, filter models.LinkFilter) (links []*models.LinkScheme, err error)
+
+	CreateApiKey(ctx context.Context, name string, keyHash string) (key *models.ApiKeyScheme, err error)
+	GetApiKey(ctx context.Context, keyHash string) (key *models.ApiKeyScheme, err error)
+	ListApiKeys(ctx context.Context) (keys []*models.ApiKeyScheme, err error)
+	RevokeApiKey(ctx context.Context, id int64) (err error)
+}
+
+//DestinationPolicy decides if destination may be shortened
+type DestinationPolicy interface {
+	Check(url string, ownerKeyId int64) error
+}
+
+//GeoLocator finds where ip is, location of unknown ip is empty
+type GeoLocator interface {
+	Locate(ip string) models.GeoLocation
+}
+
+//Config holds limits applied to new short links.
+//StripTrackingParams drops utm_* and other tracking parameters from destinations.
+//Policy is consulted for every destination if it's set, Geo locates clicks if it's set
+type Config struct {
+	DefaultTTL          time.Duration
+	MaxTTL              time.Duration
+	AllowNeverExpires   bool
+	StripTrackingParams bool
+	Policy              DestinationPolicy
+	Geo                 GeoLocator
 }
 
 type UrlShortener struct {
-	repo UrlShortenerRepo
+	//counters go first to be 64-bit aligned for atomic operations
+	created uint64
+
+	repo       UrlShortenerRepo
+	config     Config
+	normalizer *urlnorm.Normalizer
+
+	saltsMu sync.Mutex
+	salts   map[string]string
 }
 
-func NewUrlShortener(r UrlShortenerRepo) *UrlShortener {
+func NewUrlShortener(r UrlShortenerRepo, cfg Config) *UrlShortener {
 	return &UrlShortener{
-		repo: r,
+		repo:       r,
+		config:     cfg,
+		normalizer: urlnorm.NewNormalizer(urlnorm.Options{StripTrackingParams: cfg.StripTrackingParams}),
+		salts:      make(map[string]string),
 	}
 }
 
 //GenerateShortUrl returns scheme with shortId and relative data
-func (us *UrlShortener) GenerateShortUrl(url models.FullUrlScheme) (data *models.ShortLinkScheme, err error) {
-	data, err = us.repo.GenerateShortUrl(url)
+func (us *UrlShortener) GenerateShortUrl(ctx context.Context, url models.FullUrlScheme) (data *models.ShortLinkScheme, err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.GenerateShortUrl")
+	defer func() { endSpan(span, err) }()
+
+	err = us.validate(&url, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("generate short url error: %w", err)
+	}
+
+	data, err = us.repo.GenerateShortUrl(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("generate short url error: %w", err)
 	}
+	atomic.AddUint64(&us.created, 1)
 
 	return data, nil
 }
 
+//Stats are counters since start, links returned again by dedupe and idempotency keys are counted as created
+type Stats struct {
+	LinksCreated uint64
+}
+
+func (us *UrlShortener) Stats() Stats {
+	return Stats{LinksCreated: atomic.LoadUint64(&us.created)}
+}
+
+//validate brings url to canonical form, consults destination policy, checks requested alias,
+//prepares dedupe and resolves link's expiration
+func (us *UrlShortener) validate(url *models.FullUrlScheme, now time.Time) error {
+	var err error
+	url.Url, err = us.normalizer.Normalize(url.Url)
+	if err != nil {
+		return err
+	}
+
+	err = us.checkDestination(url.Url, url.OwnerKeyId)
+	if err != nil {
+		return err
+	}
+
+	if url.Alias != "" {
+		err = validateAlias(url.Alias)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = prepareDedupe(url)
+	if err != nil {
+		return err
+	}
+
+	return us.resolveExpiration(url, now)
+}
+
+//checkDestination consults destination policy if it's configured
+func (us *UrlShortener) checkDestination(url string, ownerKeyId int64) error {
+	if us.config.Policy == nil {
+		return nil
+	}
+	return us.config.Policy.Check(url, ownerKeyId)
+}
+
 //GetFullUrl converts short id into full url for redirect
-func (us *UrlShortener) GetFullUrl(shortId string) (urlScheme *models.FullUrlScheme, err error) {
-	urlScheme, err = us.repo.GetFullUrl(shortId)
+func (us *UrlShortener) GetFullUrl(ctx context.Context, shortId string) (urlScheme *models.FullUrlScheme, err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.GetFullUrl")
+	defer func() { endSpan(span, err) }()
+
+	urlScheme, err = us.repo.GetFullUrl(ctx, shortId)
 	if err != nil {
 		return nil, fmt.Errorf("get full url error: %w", err)
 	}
@@ -42,22 +158,53 @@ func (us *UrlShortener) GetFullUrl(shortId string) (urlScheme *models.FullUrlSch
 	return urlScheme, nil
 }
 
-//RegisterClick collects statistics for shortId
-func (us *UrlShortener) RegisterClick(shortId string, ip string) (err error) {
-	err = us.repo.RegisterClick(shortId, ip)
+//RegisterClicks recognizes clients, visitors and locations of batch of clicks and collects statistics for them at once
+func (us *UrlShortener) RegisterClicks(ctx context.Context, clicks []models.ClickEvent) (err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.RegisterClicks")
+	defer func() { endSpan(span, err) }()
+
+	for i := range clicks {
+		enrichClick(&clicks[i])
+		if us.config.Geo != nil {
+			clicks[i].GeoLocation = us.config.Geo.Locate(clicks[i].IP)
+		}
+		clicks[i].VisitorHash, err = us.visitorHash(ctx, &clicks[i])
+		if err != nil {
+			return fmt.Errorf("register clicks error: %w", err)
+		}
+	}
+
+	err = us.repo.RegisterClicks(ctx, clicks)
 	if err != nil {
-		return fmt.Errorf("register click error: %w", err)
+		return fmt.Errorf("register clicks error: %w", err)
 	}
 
 	return nil
 }
 
-//RegisterClick statistics scheme for shortId using statId
-func (us *UrlShortener) GetStats(statId string) (ss *models.StatsScheme, err error) {
-	ss, err = us.repo.GetStats(statId)
+//GetStats returns statistics scheme for shortId using statId
+func (us *UrlShortener) GetStats(ctx context.Context, statId string, filter models.StatsFilter) (ss *models.StatsScheme, err error) {
+	ctx, span := startSpan(ctx, "UrlShortener.GetStats")
+	defer func() { endSpan(span, err) }()
+
+	ss, err = us.repo.GetStats(ctx, statId, filter)
 	if err != nil {
 		return nil, fmt.Errorf("get stats error: %w", err)
 	}
 
 	return ss, nil
 }
+
+//startSpan starts child of the current span with tracer of its provider, untraced requests get no spans
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, name)
+}
+
+//endSpan ends span, non-nil err marks it as failed
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
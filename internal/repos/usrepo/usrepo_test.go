@@ -1,29 +1,63 @@
 package usrepo
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
 	"testing"
+	"time"
+	"urlshortener/internal/hll"
 	"urlshortener/internal/models"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
+var testConfig = Config{
+	DefaultTTL:        30 * 24 * time.Hour,
+	MaxTTL:            365 * 24 * time.Hour,
+	AllowNeverExpires: true,
+}
+
 type mockStorage struct {
+	lastUrl    models.FullUrlScheme
+	lastUpdate models.LinkUpdateScheme
+	lastFilter models.LinkFilter
+	linkCount  int64
+	apiKeys    map[string]*models.ApiKeyScheme
+	rollups    []*models.ClickRollup
+	lastFrom   time.Time
+	statsScans int
+
+	saltRequests int
+	lastClicks   []models.ClickEvent
 }
 
-func (m *mockStorage) GenerateShortUrl(url models.FullUrlScheme) (data *models.ShortLinkScheme, err error) {
+func (m *mockStorage) GenerateShortUrl(ctx context.Context, url models.FullUrlScheme) (data *models.ShortLinkScheme, err error) {
+	m.lastUrl = url
 	return &models.ShortLinkScheme{ShortId: "AQ"}, nil
 }
 
-func (m *mockStorage) RegisterClick(shortId string, ip string) (err error) {
+func (m *mockStorage) GenerateShortUrls(ctx context.Context, urls []models.FullUrlScheme) (results []models.GenerateResult, err error) {
+	for _, url := range urls {
+		m.lastUrl = url
+		results = append(results, models.GenerateResult{Data: &models.ShortLinkScheme{FullUrl: url.Url, ShortId: url.Alias}})
+	}
+	return results, nil
+}
+
+func (m *mockStorage) RegisterClicks(ctx context.Context, clicks []models.ClickEvent) (err error) {
+	m.lastClicks = clicks
 	return nil
 }
 
-func (m *mockStorage) GetFullUrl(shortId string) (urlScheme *models.FullUrlScheme, err error) {
-	return &models.FullUrlScheme{Url: "http:\\yandex.ru"}, nil
+func (m *mockStorage) GetFullUrl(ctx context.Context, shortId string) (urlScheme *models.FullUrlScheme, err error) {
+	return &models.FullUrlScheme{Url: "http://yandex.ru"}, nil
 }
 
-func (m *mockStorage) GetStats(statId string) (ss *models.StatsScheme, err error) {
+func (m *mockStorage) GetStats(ctx context.Context, statId string, filter models.StatsFilter) (ss *models.StatsScheme, err error) {
+	m.statsScans++
 	var clicks []*models.ClickScheme
 	click := &models.ClickScheme{
 		IP: "127.0.0.1",
@@ -33,46 +67,183 @@ func (m *mockStorage) GetStats(statId string) (ss *models.StatsScheme, err error
 	return &models.StatsScheme{ClickCount: int64(1), Clicks: clicks}, nil
 }
 
+func (m *mockStorage) GetClickRollups(ctx context.Context, statId string, from time.Time, to time.Time) (rollups []*models.ClickRollup, err error) {
+	m.lastFrom = from
+	return m.rollups, nil
+}
+
+func (m *mockStorage) GetStatsTotals(ctx context.Context, statId string, filter models.StatsFilter) (ss *models.StatsScheme, err error) {
+	ss = &models.StatsScheme{}
+	for _, rollup := range m.rollups {
+		ss.ClickCount += rollup.Clicks
+	}
+	return ss, nil
+}
+
+func (m *mockStorage) VisitorSalt(ctx context.Context, day string, salt string) (saved string, err error) {
+	m.saltRequests++
+	return "salt of " + day, nil
+}
+
+func (m *mockStorage) GetLink(ctx context.Context, shortId string) (link *models.LinkScheme, err error) {
+	if shortId != "AQ" {
+		return nil, models.ErrLinkNotFound
+	}
+	return &models.LinkScheme{ShortId: "AQ", StatId: "stat", OwnerKeyId: 1}, nil
+}
+
+func (m *mockStorage) UpdateLink(ctx context.Context, shortId string, update models.LinkUpdateScheme) (link *models.LinkScheme, err error) {
+	m.lastUpdate = update
+	return &models.LinkScheme{ShortId: shortId, FullUrl: update.Url, ExpirationDate: update.ExpirationDate}, nil
+}
+
+func (m *mockStorage) DeleteLink(ctx context.Context, shortId string) (err error) {
+	return nil
+}
+
+func (m *mockStorage) ListLinks(ctx context.Context, filter models.LinkFilter) (links []*models.LinkScheme, err error) {
+	m.lastFilter = filter
+	for id := m.linkCount; id > 0 && len(links) < filter.Limit; id-- {
+		if filter.AfterId != 0 && id >= filter.AfterId {
+			continue
+		}
+		links = append(links, &models.LinkScheme{Id: id})
+	}
+	return links, nil
+}
+
+func (m *mockStorage) CreateApiKey(ctx context.Context, name string, keyHash string) (key *models.ApiKeyScheme, err error) {
+	if m.apiKeys == nil {
+		m.apiKeys = make(map[string]*models.ApiKeyScheme)
+	}
+	key = &models.ApiKeyScheme{Id: int64(len(m.apiKeys) + 1), Name: name}
+	m.apiKeys[keyHash] = key
+	return &models.ApiKeyScheme{Id: key.Id, Name: name}, nil
+}
+
+func (m *mockStorage) GetApiKey(ctx context.Context, keyHash string) (key *models.ApiKeyScheme, err error) {
+	key, ok := m.apiKeys[keyHash]
+	if !ok {
+		return nil, models.ErrApiKeyNotFound
+	}
+	return key, nil
+}
+
+func (m *mockStorage) ListApiKeys(ctx context.Context) (keys []*models.ApiKeyScheme, err error) {
+	for _, key := range m.apiKeys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (m *mockStorage) RevokeApiKey(ctx context.Context, id int64) (err error) {
+	for _, key := range m.apiKeys {
+		if key.Id == id {
+			key.RevokedAt = time.Now().Format(time.RFC3339)
+			return nil
+		}
+	}
+	return models.ErrApiKeyNotFound
+}
+
 func TestGenerateShortUrl(t *testing.T) {
+	ctx := context.Background()
 
 	d := &mockStorage{}
-	us := NewUrlShortener(d)
+	us := NewUrlShortener(d, testConfig)
 
 	fus := models.FullUrlScheme{
-		Url: "http:\\yandex.ru",
+		Url: "http://yandex.ru",
 	}
-	res, _ := us.GenerateShortUrl(fus)
+	res, _ := us.GenerateShortUrl(ctx, fus)
 	assert.Equal(t, "AQ", res.ShortId)
 }
 
+func TestGenerateShortUrlAlias(t *testing.T) {
+	ctx := context.Background()
+	d := &mockStorage{}
+	us := NewUrlShortener(d, testConfig)
+
+	_, err := us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "http://yandex.ru", Alias: "release-notes"})
+	assert.NoError(t, err)
+
+	for _, alias := range []string{"ab", "stat", "Generate", "release notes", "релиз"} {
+		_, err = us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "http://yandex.ru", Alias: alias})
+		assert.ErrorIs(t, err, models.ErrInvalidAlias, alias)
+	}
+}
+
+func TestGenerateShortUrlExpiration(t *testing.T) {
+	ctx := context.Background()
+	d := &mockStorage{}
+	us := NewUrlShortener(d, testConfig)
+
+	_, err := us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "http://yandex.ru", TTL: 3600})
+	assert.NoError(t, err)
+	expirationDate, _ := time.Parse(time.RFC3339, d.lastUrl.ExpirationDate)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expirationDate, time.Minute)
+
+	_, err = us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "http://yandex.ru"})
+	assert.NoError(t, err)
+	expirationDate, _ = time.Parse(time.RFC3339, d.lastUrl.ExpirationDate)
+	assert.WithinDuration(t, time.Now().Add(testConfig.DefaultTTL), expirationDate, time.Minute)
+
+	requested := time.Now().Add(24 * time.Hour).In(time.FixedZone("MSK", 3*3600)).Truncate(time.Second)
+	_, err = us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "http://yandex.ru", ExpirationDate: requested.Format(time.RFC3339)})
+	assert.NoError(t, err)
+	assert.Equal(t, requested.UTC().Format(time.RFC3339), d.lastUrl.ExpirationDate)
+
+	_, err = us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "http://yandex.ru", NeverExpires: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "", d.lastUrl.ExpirationDate)
+
+	invalid := []models.FullUrlScheme{
+		{Url: "http://yandex.ru", TTL: -1},
+		{Url: "http://yandex.ru", ExpirationDate: "2000-01-01"},
+		{Url: "http://yandex.ru", ExpirationDate: "tomorrow"},
+		{Url: "http://yandex.ru", TTL: 10 * 365 * 24 * 3600},
+		{Url: "http://yandex.ru", TTL: 3600, NeverExpires: true},
+	}
+	for _, url := range invalid {
+		_, err = us.GenerateShortUrl(ctx, url)
+		assert.ErrorIs(t, err, models.ErrInvalidExpiration)
+	}
+
+	us = NewUrlShortener(d, Config{DefaultTTL: time.Hour})
+	_, err = us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "http://yandex.ru", NeverExpires: true})
+	assert.ErrorIs(t, err, models.ErrInvalidExpiration)
+}
+
 func TestGetFullUrl(t *testing.T) {
+	ctx := context.Background()
 	d := &mockStorage{}
-	us := NewUrlShortener(d)
+	us := NewUrlShortener(d, testConfig)
 
 	fus := models.FullUrlScheme{
-		Url: "http:\\yandex.ru",
+		Url: "http://yandex.ru",
 	}
-	su, _ := us.GenerateShortUrl(fus)
-	res, _ := us.GetFullUrl(su.ShortId)
+	su, _ := us.GenerateShortUrl(ctx, fus)
+	res, _ := us.GetFullUrl(ctx, su.ShortId)
 
-	assert.Equal(t, "http:\\yandex.ru", res.Url)
+	assert.Equal(t, "http://yandex.ru", res.Url)
 
 }
 
 func TestGetStats(t *testing.T) {
+	ctx := context.Background()
 	d := &mockStorage{}
-	us := NewUrlShortener(d)
+	us := NewUrlShortener(d, testConfig)
 
 	fus := models.FullUrlScheme{
-		Url: "http:\\yandex.ru",
+		Url: "http://yandex.ru",
 	}
-	su, _ := us.GenerateShortUrl(fus)
-	err := us.RegisterClick(su.ShortId, "127.0.0.1")
+	su, _ := us.GenerateShortUrl(ctx, fus)
+	err := us.RegisterClicks(ctx, []models.ClickEvent{{ShortId: su.ShortId, IP: "127.0.0.1", Time: time.Now()}})
 	if err != nil {
 		log := getLog()
 		log.Error(err)
 	}
-	stats, _ := d.GetStats(su.StatId)
+	stats, _ := d.GetStats(ctx, su.StatId, models.StatsFilter{})
 
 	assert.Equal(t, int64(1), stats.ClickCount)
 	assert.Equal(t, "127.0.0.1", stats.Clicks[0].IP)
@@ -91,3 +262,404 @@ func getLog() *logrus.Logger {
 
 	return log
 }
+
+func TestApiKeys(t *testing.T) {
+	ctx := context.Background()
+	d := &mockStorage{}
+	us := NewUrlShortener(d, testConfig)
+
+	_, err := us.CreateApiKey(ctx, " ")
+	assert.ErrorIs(t, err, models.ErrInvalidInput)
+
+	key, err := us.CreateApiKey(ctx, "ci")
+	assert.NoError(t, err)
+	assert.Contains(t, key.Key, apiKeyPrefix)
+	assert.NotContains(t, d.apiKeys, key.Key)
+
+	auth, err := us.Authenticate(ctx, key.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, key.Id, auth.Id)
+
+	_, err = us.Authenticate(ctx, "us_wrong")
+	assert.ErrorIs(t, err, models.ErrUnauthorized)
+
+	assert.NoError(t, us.RevokeApiKey(ctx, key.Id))
+	_, err = us.Authenticate(ctx, key.Key)
+	assert.ErrorIs(t, err, models.ErrInvalidApiKey)
+}
+
+func TestLinkCredentials(t *testing.T) {
+	ctx := context.Background()
+	d := &mockStorage{}
+	us := NewUrlShortener(d, testConfig)
+
+	cases := []struct {
+		shortId string
+		cred    Credentials
+		err     error
+	}{
+		{"AQ", Credentials{StatId: "stat"}, nil},
+		{"AQ", Credentials{ApiKeyId: 1}, nil},
+		{"AQ", Credentials{ApiKeyId: 2, StatId: "stat"}, nil},
+		{"AQ", Credentials{}, models.ErrUnauthorized},
+		{"AQ", Credentials{StatId: "wrong"}, models.ErrForbidden},
+		{"AQ", Credentials{ApiKeyId: 2}, models.ErrForbidden},
+		{"missing", Credentials{StatId: "stat"}, models.ErrNotFound},
+	}
+
+	for _, c := range cases {
+		_, err := us.GetLink(ctx, c.shortId, c.cred)
+		if c.err == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, c.err)
+		}
+		err = us.DeleteLink(ctx, c.shortId, c.cred)
+		if c.err == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, c.err)
+		}
+	}
+}
+
+func TestUpdateLink(t *testing.T) {
+	ctx := context.Background()
+	d := &mockStorage{}
+	us := NewUrlShortener(d, testConfig)
+	cred := Credentials{StatId: "stat"}
+
+	_, err := us.UpdateLink(ctx, "AQ", models.LinkUpdateScheme{}, cred)
+	assert.ErrorIs(t, err, models.ErrInvalidInput)
+
+	_, err = us.UpdateLink(ctx, "AQ", models.LinkUpdateScheme{TTL: int64((400 * 24 * time.Hour).Seconds())}, cred)
+	assert.ErrorIs(t, err, models.ErrInvalidExpiration)
+
+	link, err := us.UpdateLink(ctx, "AQ", models.LinkUpdateScheme{Url: "http://ya.ru", TTL: 60}, cred)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://ya.ru/", link.FullUrl)
+	assert.Equal(t, int64(0), d.lastUpdate.TTL)
+	expirationDate, err := time.Parse(time.RFC3339, d.lastUpdate.ExpirationDate)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expirationDate, 2*time.Second)
+
+	_, err = us.UpdateLink(ctx, "AQ", models.LinkUpdateScheme{Url: "http://ya.ru"}, Credentials{StatId: "wrong"})
+	assert.ErrorIs(t, err, models.ErrForbidden)
+}
+
+func TestListLinks(t *testing.T) {
+	ctx := context.Background()
+	d := &mockStorage{linkCount: 5}
+	us := NewUrlShortener(d, testConfig)
+
+	_, err := us.ListLinks(ctx, models.LinkFilter{}, "")
+	assert.ErrorIs(t, err, models.ErrUnauthorized)
+
+	_, err = us.ListLinks(ctx, models.LinkFilter{OwnerKeyId: 1, Limit: maxLinksPageSize + 1}, "")
+	assert.ErrorIs(t, err, models.ErrInvalidInput)
+
+	_, err = us.ListLinks(ctx, models.LinkFilter{OwnerKeyId: 1}, "abc")
+	assert.ErrorIs(t, err, models.ErrInvalidInput)
+
+	list, err := us.ListLinks(ctx, models.LinkFilter{OwnerKeyId: 1}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultLinksPageSize+1, d.lastFilter.Limit)
+	assert.Len(t, list.Links, 5)
+	assert.Equal(t, "", list.Cursor)
+
+	list, err = us.ListLinks(ctx, models.LinkFilter{OwnerKeyId: 1, Limit: 2}, "")
+	assert.NoError(t, err)
+	assert.Len(t, list.Links, 2)
+	assert.Equal(t, "4", list.Cursor)
+
+	list, err = us.ListLinks(ctx, models.LinkFilter{OwnerKeyId: 1, Limit: 2}, list.Cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), list.Links[0].Id)
+	assert.Equal(t, "2", list.Cursor)
+
+	list, _ = us.ListLinks(ctx, models.LinkFilter{OwnerKeyId: 1, Limit: 2}, list.Cursor)
+	assert.Len(t, list.Links, 1)
+	assert.Equal(t, "", list.Cursor)
+}
+
+func TestGenerateShortUrls(t *testing.T) {
+	ctx := context.Background()
+	d := &mockStorage{}
+	us := NewUrlShortener(d, testConfig)
+
+	_, err := us.GenerateShortUrls(ctx, nil)
+	assert.ErrorIs(t, err, models.ErrInvalidInput)
+	_, err = us.GenerateShortUrls(ctx, make([]models.FullUrlScheme, MaxBatchSize+1))
+	assert.ErrorIs(t, err, models.ErrInvalidInput)
+
+	results, err := us.GenerateShortUrls(ctx, []models.FullUrlScheme{
+		{Url: "http://yandex.ru", Alias: "first"},
+		{Url: "http://yandex.ru", Alias: "stat"},
+		{Url: "http://yandex.ru", Alias: "third", TTL: -1},
+		{Url: "http://yandex.ru", Alias: "fourth"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+	assert.Equal(t, "first", results[0].Data.ShortId)
+	assert.ErrorIs(t, results[1].Err, models.ErrInvalidAlias)
+	assert.ErrorIs(t, results[2].Err, models.ErrInvalidExpiration)
+	assert.Equal(t, "fourth", results[3].Data.ShortId)
+	assert.NotEqual(t, "", d.lastUrl.ExpirationDate)
+}
+
+func TestGenerateShortUrlNormalizesUrl(t *testing.T) {
+	ctx := context.Background()
+	d := &mockStorage{}
+	us := NewUrlShortener(d, Config{DefaultTTL: time.Hour, StripTrackingParams: true})
+
+	_, err := us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "HTTPS://Пример.рф:443?utm_source=mail&id=1#top"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://xn--e1afmkfd.xn--p1ai/?id=1#top", d.lastUrl.Url)
+	assert.Equal(t, "https://xn--e1afmkfd.xn--p1ai/?id=1", d.lastUrl.NormalizedUrl)
+
+	_, err = us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "javascript:alert(1)"})
+	assert.ErrorIs(t, err, models.ErrInvalidUrl)
+	assert.Contains(t, err.Error(), "scheme 'javascript' is not allowed")
+
+	_, err = us.UpdateLink(ctx, "AQ", models.LinkUpdateScheme{Url: "http:\\yandex.ru"}, Credentials{StatId: "stat"})
+	assert.ErrorIs(t, err, models.ErrInvalidUrl)
+}
+
+func TestPrepareDedupe(t *testing.T) {
+	url := models.FullUrlScheme{Url: "http://yandex.ru", Dedupe: true, IdempotencyKey: "retry"}
+	assert.NoError(t, prepareDedupe(&url))
+	assert.False(t, url.Dedupe)
+	assert.Equal(t, "", url.IdempotencyKey)
+	assert.Equal(t, "", url.RequestHash)
+
+	first := models.FullUrlScheme{Url: "http://yandex.ru/", Dedupe: true, OwnerKeyId: 1, IdempotencyKey: "retry", TTL: 60}
+	second := first
+	second.Url = "http://yandex.ru/#top"
+	assert.NoError(t, prepareDedupe(&first))
+	assert.NoError(t, prepareDedupe(&second))
+	assert.True(t, first.Dedupe)
+	assert.Equal(t, first.RequestHash, second.RequestHash)
+	assert.Equal(t, "http://yandex.ru/", second.NormalizedUrl)
+
+	second.TTL = 120
+	assert.NoError(t, prepareDedupe(&second))
+	assert.NotEqual(t, first.RequestHash, second.RequestHash)
+
+	url = models.FullUrlScheme{Url: "http://yandex.ru", IdempotencyKey: strings.Repeat("k", maxIdempotencyKeyLength+1)}
+	assert.ErrorIs(t, prepareDedupe(&url), models.ErrInvalidInput)
+}
+
+type mockPolicy struct {
+	checked []string
+	owner   int64
+}
+
+func (m *mockPolicy) Check(url string, ownerKeyId int64) error {
+	m.checked = append(m.checked, url)
+	m.owner = ownerKeyId
+	if strings.Contains(url, "evil") {
+		return models.ErrDestinationBlocked
+	}
+	return nil
+}
+
+func TestDestinationPolicy(t *testing.T) {
+	ctx := context.Background()
+	d := &mockStorage{}
+	p := &mockPolicy{}
+	us := NewUrlShortener(d, Config{DefaultTTL: time.Hour, Policy: p})
+
+	_, err := us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "HTTP://Yandex.ru", OwnerKeyId: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://yandex.ru/"}, p.checked)
+	assert.Equal(t, int64(3), p.owner)
+
+	_, err = us.GenerateShortUrl(ctx, models.FullUrlScheme{Url: "http://evil.org"})
+	assert.ErrorIs(t, err, models.ErrDestinationBlocked)
+
+	results, err := us.GenerateShortUrls(ctx, []models.FullUrlScheme{{Url: "http://evil.org"}, {Url: "http://good.org"}})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, results[0].Err, models.ErrDestinationBlocked)
+	assert.NoError(t, results[1].Err)
+
+	_, err = us.UpdateLink(ctx, "AQ", models.LinkUpdateScheme{Url: "http://evil.org"}, Credentials{StatId: "stat"})
+	assert.ErrorIs(t, err, models.ErrDestinationBlocked)
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	cases := map[string]string{
+		"":                                    "",
+		"ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7": "ru",
+		"en-US;q=0.5, de;q=0.9":               "de",
+		"*":                                   "",
+		"fr;q=0, es":                          "es",
+		"EN":                                  "en",
+	}
+
+	for header, language := range cases {
+		assert.Equal(t, language, preferredLanguage(header), header)
+	}
+}
+
+func TestEnrichClick(t *testing.T) {
+	click := models.ClickEvent{
+		ShortId: "AQ",
+		ClickDetails: models.ClickDetails{
+			Referrer:  "https://WWW.Google.com/search?q=1",
+			UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			Language:  "de-DE,de;q=0.9",
+		},
+	}
+	enrichClick(&click)
+
+	assert.Equal(t, "google.com", click.ReferrerHost)
+	assert.Equal(t, "Safari", click.Browser)
+	assert.Equal(t, "iOS", click.OS)
+	assert.Equal(t, "mobile", click.Device)
+	assert.False(t, click.Bot)
+	assert.Equal(t, "de", click.Language)
+
+	click = models.ClickEvent{ClickDetails: models.ClickDetails{UserAgent: "Mozilla/5.0 (Windows NT 10.0) Firefox/121.0", Bot: true}}
+	enrichClick(&click)
+	assert.True(t, click.Bot)
+	assert.Equal(t, "Firefox", click.Browser)
+	assert.Equal(t, "bot", click.Device)
+
+	click = models.ClickEvent{ClickDetails: models.ClickDetails{UserAgent: strings.Repeat("a", 1000) + "\xff"}}
+	enrichClick(&click)
+	assert.Len(t, click.UserAgent, maxUserAgentLength)
+	assert.Equal(t, "", click.ReferrerHost)
+}
+
+func sketch(visitors ...string) []byte {
+	var s hll.Sketch
+	for _, visitor := range visitors {
+		sum := sha256.Sum256([]byte(visitor))
+		s.Add(binary.BigEndian.Uint64(sum[:]))
+	}
+	data, _ := s.MarshalBinary()
+	return data
+}
+
+func TestGetStatsSeries(t *testing.T) {
+	ctx := context.Background()
+	moscow := time.FixedZone("MSK", 3*3600)
+	hour := func(s string) time.Time {
+		h, _ := time.Parse(time.RFC3339, s)
+		return h
+	}
+	d := &mockStorage{rollups: []*models.ClickRollup{
+		{Hour: hour("2024-01-01T20:00:00Z"), Clicks: 2, Visitors: sketch("a", "b")},
+		{Hour: hour("2024-01-01T21:00:00Z"), Clicks: 3, Visitors: sketch("a", "c")},
+		{Hour: hour("2024-01-03T10:00:00Z"), Clicks: 1, Visitors: sketch("a")},
+	}}
+	us := NewUrlShortener(d, testConfig)
+
+	ss, err := us.GetStatsSeries(ctx, "stat", models.StatsFilter{}, models.SeriesQuery{
+		From:     hour("2024-01-01T00:00:00Z"),
+		To:       hour("2024-01-04T00:00:00Z"),
+		Location: moscow,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "day", ss.Interval)
+	assert.Equal(t, "MSK", ss.Timezone)
+	assert.Equal(t, int64(6), ss.ClickCount)
+	assert.Zero(t, d.statsScans)
+	assert.True(t, hour("2023-12-31T21:00:00Z").Equal(d.lastFrom))
+	assert.Equal(t, []*models.SeriesPointScheme{
+		{Start: "2024-01-01T00:00:00+03:00", Clicks: 2, Visitors: 2},
+		{Start: "2024-01-02T00:00:00+03:00", Clicks: 3, Visitors: 2},
+		{Start: "2024-01-03T00:00:00+03:00", Clicks: 1, Visitors: 1},
+		{Start: "2024-01-04T00:00:00+03:00", Clicks: 0, Visitors: 0},
+	}, ss.Series)
+
+	ss, err = us.GetStatsSeries(ctx, "stat", models.StatsFilter{}, models.SeriesQuery{
+		From:     hour("2024-01-01T00:00:00Z"),
+		To:       hour("2024-01-04T00:00:00Z"),
+		Interval: "week",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.SeriesPointScheme{{Start: "2024-01-01T00:00:00Z", Clicks: 6, Visitors: 3}}, ss.Series)
+
+	d.rollups[1].BotClicks = 2
+	ss, err = us.GetStatsSeries(ctx, "stat", models.StatsFilter{ExcludeBots: true}, models.SeriesQuery{
+		From:     hour("2024-01-01T00:00:00Z"),
+		To:       hour("2024-01-04T00:00:00Z"),
+		Interval: "week",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), ss.Series[0].Clicks)
+
+	_, err = us.GetStatsSeries(ctx, "stat", models.StatsFilter{}, models.SeriesQuery{Interval: "minute"})
+	assert.ErrorIs(t, err, models.ErrInvalidInput)
+	_, err = us.GetStatsSeries(ctx, "stat", models.StatsFilter{}, models.SeriesQuery{From: hour("2024-01-02T00:00:00Z"), To: hour("2024-01-01T00:00:00Z")})
+	assert.ErrorIs(t, err, models.ErrInvalidInput)
+	_, err = us.GetStatsSeries(ctx, "stat", models.StatsFilter{}, models.SeriesQuery{From: hour("2020-01-01T00:00:00Z"), Interval: "hour"})
+	assert.ErrorIs(t, err, models.ErrInvalidInput)
+}
+
+func TestIntervalStart(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	moment := time.Date(2024, 3, 31, 14, 25, 0, 0, berlin)
+
+	assert.Equal(t, time.Date(2024, 3, 31, 14, 0, 0, 0, berlin), intervalStart(moment, IntervalHour))
+	assert.Equal(t, time.Date(2024, 3, 31, 0, 0, 0, 0, berlin), intervalStart(moment, IntervalDay))
+	assert.Equal(t, time.Date(2024, 3, 25, 0, 0, 0, 0, berlin), intervalStart(moment, IntervalWeek))
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, berlin), intervalStart(moment, IntervalMonth))
+
+	//the day of switching to summer time is 23 hours long
+	day := intervalStart(moment, IntervalDay)
+	assert.Equal(t, 23*time.Hour, nextInterval(day, IntervalDay).Sub(day))
+}
+
+func TestVisitorHash(t *testing.T) {
+	ctx := context.Background()
+	d := &mockStorage{}
+	us := NewUrlShortener(d, testConfig)
+	morning := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	click := models.ClickEvent{IP: "10.0.0.1", Time: morning, ClickDetails: models.ClickDetails{UserAgent: "Firefox"}}
+	first, err := us.visitorHash(ctx, &click)
+	assert.NoError(t, err)
+	assert.NotZero(t, first)
+
+	click.Time = morning.Add(10 * time.Hour)
+	same, _ := us.visitorHash(ctx, &click)
+	assert.Equal(t, first, same)
+	assert.Equal(t, 1, d.saltRequests)
+
+	click.UserAgent = "Chrome"
+	otherAgent, _ := us.visitorHash(ctx, &click)
+	assert.NotEqual(t, first, otherAgent)
+
+	click.UserAgent = "Firefox"
+	click.Time = morning.AddDate(0, 0, 1)
+	nextDay, _ := us.visitorHash(ctx, &click)
+	assert.NotEqual(t, first, nextDay)
+	assert.Equal(t, 2, d.saltRequests)
+}
+
+type mockGeo map[string]models.GeoLocation
+
+func (m mockGeo) Locate(ip string) models.GeoLocation {
+	return m[ip]
+}
+
+func TestRegisterClicksLocation(t *testing.T) {
+	ctx := context.Background()
+	d := &mockStorage{}
+	cfg := testConfig
+	cfg.Geo = mockGeo{"81.2.69.160": {Country: "GB", Region: "England", City: "London"}}
+	us := NewUrlShortener(d, cfg)
+
+	err := us.RegisterClicks(ctx, []models.ClickEvent{
+		{ShortId: "AQ", IP: "81.2.69.160", Time: time.Now()},
+		{ShortId: "AQ", IP: "10.0.0.1", Time: time.Now()},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, models.GeoLocation{Country: "GB", Region: "England", City: "London"}, d.lastClicks[0].GeoLocation)
+	assert.Equal(t, models.GeoLocation{}, d.lastClicks[1].GeoLocation)
+}
@@ -0,0 +1,81 @@
+package usrepo
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+
+	"urlshortener/internal/hll"
+	"urlshortener/internal/models"
+)
+
+//maxCachedSalts bounds salts kept in memory, clicks normally come from today and sometimes from yesterday
+const maxCachedSalts = 7
+
+//visitorHash tells visitors apart by ip and user agent without storing them.
+//Salt is random, rotated daily and shared by all instances through storage,
+//once janitor deletes it nobody can find whose clicks the hashes were
+func (us *UrlShortener) visitorHash(ctx context.Context, click *models.ClickEvent) (uint64, error) {
+	salt, err := us.visitorSalt(ctx, click.Time.UTC().Format("2006-01-02"))
+	if err != nil {
+		return 0, err
+	}
+
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(click.IP))
+	mac.Write([]byte{0})
+	mac.Write([]byte(click.UserAgent))
+	hash := binary.BigEndian.Uint64(mac.Sum(nil))
+	if hash == 0 {
+		//zero means unknown visitor
+		hash = 1
+	}
+
+	return hash, nil
+}
+
+//visitorSalt returns salt of day creating it if the day has none yet
+func (us *UrlShortener) visitorSalt(ctx context.Context, day string) (string, error) {
+	us.saltsMu.Lock()
+	defer us.saltsMu.Unlock()
+
+	if salt, ok := us.salts[day]; ok {
+		return salt, nil
+	}
+
+	candidate := make([]byte, 32)
+	_, err := rand.Read(candidate)
+	if err != nil {
+		return "", err
+	}
+
+	salt, err := us.repo.VisitorSalt(ctx, day, hex.EncodeToString(candidate))
+	if err != nil {
+		return "", err
+	}
+
+	if len(us.salts) >= maxCachedSalts {
+		us.salts = make(map[string]string)
+	}
+	us.salts[day] = salt
+
+	return salt, nil
+}
+
+//countVisitors estimates number of unique visitors of rollups
+func countVisitors(rollups []*models.ClickRollup) (int64, error) {
+	var visitors hll.Sketch
+	for _, rollup := range rollups {
+		var hour hll.Sketch
+		err := hour.UnmarshalBinary(rollup.Visitors)
+		if err != nil {
+			return 0, err
+		}
+		visitors.Merge(&hour)
+	}
+
+	return visitors.Estimate(), nil
+}
@@ -0,0 +1,190 @@
+//Package urlnorm validates destinations of short links and brings them to canonical form
+package urlnorm
+
+import (
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"urlshortener/internal/models"
+)
+
+//MaxLength limits length of destination url
+const MaxLength = 2048
+
+var allowedSchemes = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+//trackingParams are query parameters of ad and mail campaigns, parameters starting with trackingPrefix are dropped too
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+}
+
+const trackingPrefix = "utm_"
+
+//Options control normalization, by default only validation and canonical form are applied
+type Options struct {
+	StripTrackingParams bool
+}
+
+//Normalizer validates urls and returns their canonical form
+type Normalizer struct {
+	options Options
+	profile *idna.Profile
+}
+
+func NewNormalizer(opts Options) *Normalizer {
+	return &Normalizer{
+		options: opts,
+		profile: idna.New(idna.MapForLookup(), idna.BidiRule(), idna.Transitional(false)),
+	}
+}
+
+//Normalize checks that url is an absolute http or https url with host and returns it with
+//lowercase scheme and host, punycode host, without default port and, if configured, without tracking parameters.
+//Error wraps models.ErrInvalidUrl and tells the reason
+func (n *Normalizer) Normalize(url string) (string, error) {
+	u, err := n.parse(url)
+	if err != nil {
+		return "", err
+	}
+
+	if n.options.StripTrackingParams {
+		u.RawQuery = stripTrackingParams(u.RawQuery)
+		u.ForceQuery = false
+	}
+
+	return u.String(), nil
+}
+
+//Check validates url without changing it
+func Check(url string) error {
+	_, err := NewNormalizer(Options{}).parse(url)
+	return err
+}
+
+func (n *Normalizer) parse(url string) (*neturl.URL, error) {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return nil, invalid("url is empty")
+	}
+	if len(url) > MaxLength {
+		return nil, invalid("url can't be longer than %d", MaxLength)
+	}
+
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, invalid("%v", err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	defaultPort, ok := allowedSchemes[u.Scheme]
+	if u.Scheme == "" {
+		return nil, invalid("url must be absolute, like https://example.com/path")
+	}
+	if !ok {
+		return nil, invalid("scheme '%s' is not allowed, only http and https are", u.Scheme)
+	}
+	if u.Opaque != "" {
+		return nil, invalid("url must have host after '%s://'", u.Scheme)
+	}
+	if u.User != nil {
+		return nil, invalid("url can't contain user name or password")
+	}
+
+	host, err := n.host(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	port := u.Port()
+	if port != "" {
+		number, err := strconv.Atoi(port)
+		if err != nil || number < 1 || number > 65535 {
+			return nil, invalid("port '%s' is invalid", port)
+		}
+		port = strconv.Itoa(number)
+	}
+	if port == defaultPort {
+		port = ""
+	}
+
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if port != "" {
+		u.Host = host + ":" + port
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+
+	return u, nil
+}
+
+//host validates host and returns it in lowercase ASCII form
+func (n *Normalizer) host(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", invalid("url must have host")
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return strings.ToLower(ip.String()), nil
+	}
+
+	ascii, err := n.profile.ToASCII(host)
+	if err != nil {
+		return "", invalid("host '%s' is invalid: %v", host, err)
+	}
+
+	return ascii, nil
+}
+
+//stripTrackingParams removes tracking parameters keeping order and encoding of the others
+func stripTrackingParams(query string) string {
+	if query == "" {
+		return ""
+	}
+
+	var kept []string
+	for _, param := range strings.Split(query, "&") {
+		name := param
+		if i := strings.Index(param, "="); i >= 0 {
+			name = param[:i]
+		}
+		if unescaped, err := neturl.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		name = strings.ToLower(name)
+
+		if trackingParams[name] || strings.HasPrefix(name, trackingPrefix) {
+			continue
+		}
+		kept = append(kept, param)
+	}
+
+	return strings.Join(kept, "&")
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", models.ErrInvalidUrl, fmt.Sprintf(format, args...))
+}
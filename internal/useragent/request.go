@@ -0,0 +1,26 @@
+package useragent
+
+import (
+	"net/http"
+	"strings"
+)
+
+//purposeHeaders tell that browser loads page in advance or for preview, not because user opened it
+var purposeHeaders = []string{"Purpose", "Sec-Purpose", "X-Purpose", "X-Moz"}
+
+//AutomatedRequest tells if request wasn't made by a person whatever its user agent says.
+//Browsers always send Accept on navigation and mark prefetches and previews
+func AutomatedRequest(header http.Header) bool {
+	if header.Get("Accept") == "" {
+		return true
+	}
+
+	for _, name := range purposeHeaders {
+		value := strings.ToLower(header.Get(name))
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "preview") || strings.Contains(value, "prerender") {
+			return true
+		}
+	}
+
+	return false
+}
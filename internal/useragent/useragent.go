@@ -0,0 +1,135 @@
+//Package useragent recognizes browser, operating system and device class of User-Agent header
+package useragent
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+//Device classes
+const (
+	Desktop = "desktop"
+	Mobile  = "mobile"
+	Tablet  = "tablet"
+	Bot     = "bot"
+)
+
+//Info describes client, fields are empty if they aren't recognized
+type Info struct {
+	Browser string
+	OS      string
+	Device  string
+	Bot     bool
+}
+
+//token is a name recognized by any of substrings
+type token struct {
+	name     string
+	patterns []string
+}
+
+//botList is the maintained list of bots, see the file for its format
+//
+//go:embed bots.txt
+var botList string
+
+//bots are matched in lowercased user agent
+var bots = parseBots(botList)
+
+//browsers are matched in order, the first match wins since most browsers mention others
+var browsers = []token{
+	{"Edge", []string{"Edg/", "EdgA/", "EdgiOS/", "Edge/"}},
+	{"Opera", []string{"OPR/", "Opera"}},
+	{"Yandex", []string{"YaBrowser/"}},
+	{"Samsung Internet", []string{"SamsungBrowser/"}},
+	{"Firefox", []string{"Firefox/", "FxiOS/"}},
+	{"Chrome", []string{"Chrome/", "CriOS/"}},
+	{"Safari", []string{"Safari/"}},
+	{"Internet Explorer", []string{"MSIE ", "Trident/"}},
+}
+
+var systems = []token{
+	{"Windows", []string{"Windows"}},
+	{"Android", []string{"Android"}},
+	{"iOS", []string{"iPhone", "iPad", "iPod"}},
+	{"macOS", []string{"Macintosh", "Mac OS X"}},
+	{"Chrome OS", []string{"CrOS"}},
+	{"Linux", []string{"Linux"}},
+}
+
+//Parse recognizes user agent, empty one is unknown.
+//Besides listed bots, user agents linking to bot's description and
+//unknown clients which don't pretend to be a browser are bots too
+func Parse(ua string) Info {
+	if strings.TrimSpace(ua) == "" {
+		return Info{}
+	}
+
+	lower := strings.ToLower(ua)
+	if name := match(bots, lower); name != "" {
+		return Info{Browser: name, OS: match(systems, ua), Device: Bot, Bot: true}
+	}
+
+	info := Info{
+		Browser: match(browsers, ua),
+		OS:      match(systems, ua),
+		Device:  Desktop,
+	}
+
+	if strings.Contains(lower, "http://") || strings.Contains(lower, "https://") ||
+		(info.Browser == "" && !strings.HasPrefix(ua, "Mozilla/")) {
+		return Info{OS: info.OS, Device: Bot, Bot: true}
+	}
+
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		(info.OS == "Android" && !strings.Contains(ua, "Mobile")):
+		info.Device = Tablet
+	case strings.Contains(ua, "Mobi") || info.OS == "iOS" || info.OS == "Android":
+		info.Device = Mobile
+	}
+
+	return info
+}
+
+func match(tokens []token, ua string) string {
+	for _, t := range tokens {
+		for _, pattern := range t.patterns {
+			if strings.Contains(ua, pattern) {
+				return t.name
+			}
+		}
+	}
+	return ""
+}
+
+//parseBots reads list of bots, the list is a part of binary so mistakes in it panic
+func parseBots(list string) []token {
+	var tokens []token
+	for n, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			panic(fmt.Sprintf("bots.txt:%d: name of bot is missing", n+1))
+		}
+
+		t := token{name: strings.TrimSpace(line[:i])}
+		for _, pattern := range strings.Split(line[i+1:], ",") {
+			pattern = strings.ToLower(strings.TrimSpace(pattern))
+			if pattern != "" {
+				t.patterns = append(t.patterns, pattern)
+			}
+		}
+		if len(t.patterns) == 0 {
+			panic(fmt.Sprintf("bots.txt:%d: patterns of %s are missing", n+1, t.name))
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens
+}
@@ -0,0 +1,113 @@
+package useragent
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := map[string]Info{
+		"": {},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36": {
+			Browser: "Chrome", OS: "Windows", Device: Desktop,
+		},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0": {
+			Browser: "Edge", OS: "Windows", Device: Desktop,
+		},
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_2) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15": {
+			Browser: "Safari", OS: "macOS", Device: Desktop,
+		},
+		"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0": {
+			Browser: "Firefox", OS: "Linux", Device: Desktop,
+		},
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1": {
+			Browser: "Safari", OS: "iOS", Device: Mobile,
+		},
+		"Mozilla/5.0 (iPad; CPU OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1": {
+			Browser: "Chrome", OS: "iOS", Device: Tablet,
+		},
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36": {
+			Browser: "Chrome", OS: "Android", Device: Mobile,
+		},
+		"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Safari/537.36": {
+			Browser: "Samsung Internet", OS: "Android", Device: Tablet,
+		},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 YaBrowser/23.11.0.0 Safari/537.36": {
+			Browser: "Yandex", OS: "Windows", Device: Desktop,
+		},
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)": {
+			Browser: "Slackbot", Device: Bot, Bot: true,
+		},
+		"TelegramBot (like TwitterBot)": {
+			Browser: "TelegramBot", Device: Bot, Bot: true,
+		},
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": {
+			Browser: "Googlebot", Device: Bot, Bot: true,
+		},
+		"curl/8.4.0": {
+			Browser: "curl", Device: Bot, Bot: true,
+		},
+		"SomethingNew/1.0": {
+			Device: Bot, Bot: true,
+		},
+		"Mozilla/5.0 (Windows NT 10.0) SomethingNew/1.0": {
+			OS: "Windows", Device: Desktop,
+		},
+		"Mozilla/5.0 (compatible; SomeAgentPlus/2.0; +https://example.com/about)": {
+			Device: Bot, Bot: true,
+		},
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)": {
+			Browser: "Facebook", Device: Bot, Bot: true,
+		},
+		"Mozilla/5.0 (Windows NT 6.1; WOW64) SkypeUriPreview Preview/0.5 skype-url-preview@microsoft.com": {
+			Browser: "SkypeUriPreview", OS: "Windows", Device: Bot, Bot: true,
+		},
+		"Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.71 Mobile Safari/537.36 (compatible; GoogleOther)": {
+			Browser: "Google-PageRenderer", OS: "Android", Device: Bot, Bot: true,
+		},
+		"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; GPTBot/1.0; +https://openai.com/gptbot)": {
+			Browser: "GPTBot", Device: Bot, Bot: true,
+		},
+		"python-requests/2.31.0": {
+			Browser: "python", Device: Bot, Bot: true,
+		},
+		"okhttp/4.12.0": {
+			Browser: "Java", Device: Bot, Bot: true,
+		},
+		"Mozilla/5.0 (compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)": {
+			Browser: "UptimeRobot", Device: Bot, Bot: true,
+		},
+	}
+
+	for ua, info := range cases {
+		assert.Equal(t, info, Parse(ua), ua)
+	}
+}
+
+func TestParseBots(t *testing.T) {
+	tokens := parseBots("# comment\n\nFirst: one, Two \nSecond:three")
+	assert.Equal(t, []token{{"First", []string{"one", "two"}}, {"Second", []string{"three"}}}, tokens)
+
+	assert.Panics(t, func() { parseBots("no name") })
+	assert.Panics(t, func() { parseBots("Name: ,") })
+	assert.NotEmpty(t, bots)
+}
+
+func TestAutomatedRequest(t *testing.T) {
+	browser := func(extra ...string) http.Header {
+		header := http.Header{"Accept": {"text/html"}}
+		for i := 0; i+1 < len(extra); i += 2 {
+			header.Set(extra[i], extra[i+1])
+		}
+		return header
+	}
+
+	assert.False(t, AutomatedRequest(browser()))
+	assert.True(t, AutomatedRequest(http.Header{}))
+	assert.True(t, AutomatedRequest(browser("Sec-Purpose", "prefetch;prerender")))
+	assert.True(t, AutomatedRequest(browser("Purpose", "prefetch")))
+	assert.True(t, AutomatedRequest(browser("X-Purpose", "preview")))
+	assert.True(t, AutomatedRequest(browser("X-Moz", "prefetch")))
+}